@@ -0,0 +1,235 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MismatchAction decide what GetSession does when the client
+// attributes do not match the session binding.
+type MismatchAction uint8
+
+const (
+	RejectMismatch     MismatchAction = iota // Remove the session and start a new one
+	RegenerateMismatch                       // Keep the session and start a new empty one for the client
+	ReportMismatch                           // Keep the session, only call OnMismatch
+)
+
+// client attributes recorded in session binding
+const (
+	bindUserAgent = "ua"
+	bindIP        = "ip"
+	bindTLS       = "tls"
+)
+
+// Binding bind session to client attributes recorded when it is created,
+// a stolen session token is detected when it is used by another client.
+type Binding struct {
+	// UserAgent bind the hash of User-Agent header
+	UserAgent bool
+	// IP bind client ip, IPv4Mask and IPv6Mask bind the subnet prefix
+	// bits instead of the full address, e.g. 24 and 64.
+	IP       bool
+	IPv4Mask int
+	IPv6Mask int
+	// TrustedProxies are proxy ips or CIDRs whose X-Forwarded-For is trusted,
+	// otherwise the remote address is the client ip.
+	TrustedProxies []string
+	// TLS return client TLS fingerprint, e.g. JA3 passed by the proxy
+	TLS func(req *http.Request) string
+	// Action on mismatch, default RejectMismatch
+	Action MismatchAction
+	// OnMismatch report the mismatched attribute, it is called for every action
+	OnMismatch func(req *http.Request, s *Session, attr string)
+
+	proxies []*net.IPNet
+}
+
+// validate check binding and return a copy with parsed proxies
+func (b *Binding) validate(ve *ValidationError) *Binding {
+	nb := *b
+	if !nb.UserAgent && !nb.IP && nb.TLS == nil {
+		ve.add("Binding", "binds no client attribute")
+	}
+	if nb.IPv4Mask < 0 || nb.IPv4Mask > 32 {
+		ve.add("Binding", "IPv4Mask is out of range")
+	} else if nb.IPv4Mask == 0 {
+		nb.IPv4Mask = 32
+	}
+	if nb.IPv6Mask < 0 || nb.IPv6Mask > 128 {
+		ve.add("Binding", "IPv6Mask is out of range")
+	} else if nb.IPv6Mask == 0 {
+		nb.IPv6Mask = 128
+	}
+	if nb.Action > ReportMismatch {
+		ve.add("Binding", "Action is unknown")
+	}
+	nb.proxies = nil
+	for _, raw := range nb.TrustedProxies {
+		proxy := raw
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			ve.add("Binding", "trusted proxy "+raw+" is illegal")
+			continue
+		}
+		nb.proxies = append(nb.proxies, network)
+	}
+	return &nb
+}
+
+// fingerprint return client attribute hashes of the request
+func (b *Binding) fingerprint(req *http.Request) map[string]string {
+	if b == nil {
+		return nil
+	}
+	fp := make(map[string]string, 3)
+	if b.UserAgent {
+		fp[bindUserAgent] = hashAttr(req.UserAgent())
+	}
+	if b.IP {
+		fp[bindIP] = hashAttr(b.subnet(b.clientIP(req)))
+	}
+	if b.TLS != nil {
+		fp[bindTLS] = hashAttr(b.TLS(req))
+	}
+	return fp
+}
+
+// verify compare request attributes with session binding, attributes
+// not recorded in the session yet, e.g. before binding is enabled, are
+// recorded on the first read and reported by bound.
+func (b *Binding) verify(s *Session, req *http.Request) (attr string, bound, ok bool) {
+	if b == nil {
+		return "", false, true
+	}
+	fp := b.fingerprint(req)
+	for _, attr := range []string{bindUserAgent, bindIP, bindTLS} {
+		if stored, ok := s.binding[attr]; ok && stored != fp[attr] {
+			return attr, false, false
+		}
+	}
+	binding := make(map[string]string, len(fp))
+	for attr, hash := range s.binding {
+		binding[attr] = hash
+	}
+	for attr, hash := range fp {
+		if _, ok := binding[attr]; !ok {
+			binding[attr] = hash
+			bound = true
+		}
+	}
+	if bound {
+		s.binding = binding
+	}
+	return "", bound, true
+}
+
+// clientIP return client ip, X-Forwarded-For is walked from the
+// nearest hop while the hop is a trusted proxy.
+func (b *Binding) clientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !b.trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !b.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted check whether ip is a trusted proxy
+func (b *Binding) trusted(ip net.IP) bool {
+	for _, network := range b.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// subnet return masked client ip
+func (b *Binding) subnet(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(b.IPv4Mask, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(b.IPv6Mask, 128)).String()
+}
+
+// hashAttr return short hash of client attribute
+func hashAttr(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// mismatch handle session used by another client by binding action
+func (m *Manager) mismatch(ctx context.Context, w http.ResponseWriter, req *http.Request, s *Session, attr string) (*Session, error) {
+	debug.trace(s, attr)
+	b := m.cfg.Binding
+	if b.OnMismatch != nil {
+		b.OnMismatch(req, s, attr)
+	}
+	switch b.Action {
+	case ReportMismatch:
+		if err := m.renew(ctx, w, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case RegenerateMismatch:
+		// the client must not inherit principal or values of the session
+		return m.createSession(ctx, w, req)
+	default:
+		if m.cs().RemoveContext(ctx, s) == nil {
+			s.removed = true
+			m.emit(ctx, EventInvalidate, s, "")
+		}
+		return m.createSession(ctx, w, req)
+	}
+}
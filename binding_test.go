@@ -0,0 +1,126 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBinding testing session hijack detection by client attributes
+func TestBinding(t *testing.T) {
+	request := func(cookie *http.Cookie, remote, forwarded, agent string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("User-Agent", agent)
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		agent     string
+		action    MismatchAction
+		attr      string
+		same      bool
+	}{
+		{"same client", "10.0.0.1:1234", "203.0.113.7", "firefox", RejectMismatch, "", true},
+		{"same subnet", "10.0.0.1:1234", "203.0.113.99", "firefox", RejectMismatch, "", true},
+		{"spoofed forwarded from untrusted", "198.51.100.1:1234", "203.0.113.7", "firefox", RejectMismatch, bindIP, false},
+		{"other agent", "10.0.0.1:1234", "203.0.113.7", "curl", RejectMismatch, bindUserAgent, false},
+		{"regenerate", "10.0.0.1:1234", "192.0.2.1", "firefox", RegenerateMismatch, bindIP, false},
+		{"report", "10.0.0.1:1234", "192.0.2.1", "firefox", ReportMismatch, bindIP, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported string
+			opt := NewOptions(WithBinding(Binding{
+				UserAgent:      true,
+				IP:             true,
+				IPv4Mask:       24,
+				TrustedProxies: []string{"10.0.0.0/8"},
+				Action:         tt.action,
+				OnMismatch: func(req *http.Request, s *Session, attr string) {
+					reported = attr
+				},
+			}))
+			m, err := NewManager(&opt, NewRAM())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			origin, _ := m.GetSession(w, request(nil, "10.0.0.1:1234", "198.51.100.9, 203.0.113.7", "firefox"))
+			origin.Values["user"] = "leon"
+			_ = origin.Sync()
+
+			s, err := m.GetSession(httptest.NewRecorder(), request(w.Result().Cookies()[0], tt.remote, tt.forwarded, tt.agent))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reported != tt.attr {
+				t.Errorf("reported %q, want %q", reported, tt.attr)
+			}
+			if same := s.ID() == origin.ID(); same != tt.same {
+				t.Errorf("same session = %v, want %v", same, tt.same)
+			}
+			if kept := s.Values["user"] == "leon"; kept != tt.same {
+				t.Errorf("values kept = %v", kept)
+			}
+			var stored Session
+			stored.id = origin.ID()
+			if alive := m.Storage().Read(&stored) == nil; alive != (tt.same || tt.action != RejectMismatch) {
+				t.Errorf("origin session alive = %v", alive)
+			}
+		})
+	}
+
+	// session created before binding is enabled is bound on first read
+	opt := NewOptions(WithBinding(Binding{UserAgent: true}))
+	m, err := NewManager(&opt, NewRAM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbound := m.NewSession()
+	_ = unbound.Sync()
+	cookie := &http.Cookie{Name: m.cfg.CookieName, Value: m.encodeValue(unbound.ID())}
+	if s, _ := m.GetSession(httptest.NewRecorder(), request(cookie, "10.0.0.1:1234", "", "firefox")); s.ID() != unbound.ID() {
+		t.Fatal("unbound session not read")
+	}
+	if s, _ := m.GetSession(httptest.NewRecorder(), request(cookie, "10.0.0.1:1234", "", "curl")); s.ID() == unbound.ID() {
+		t.Error("binding not recorded on first read")
+	}
+
+	opt = NewOptions(WithBinding(Binding{TrustedProxies: []string{"proxy"}}))
+	if _, err := opt.Parse(); err == nil {
+		t.Error("Parse() should reject empty binding and illegal proxy")
+	}
+}
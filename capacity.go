@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// evictionSamples is number of sessions sampled to pick an eviction victim
+const evictionSamples = 16
+
+// Eviction decide which session RamStore evicts when it is over capacity.
+type Eviction uint8
+
+const (
+	EvictionLRU Eviction = iota // Evict the least recently used session
+	EvictionLFU                 // Evict the least frequently used session
+)
+
+// String return eviction name used by config
+func (e Eviction) String() string {
+	if e == EvictionLFU {
+		return "lfu"
+	}
+	return "lru"
+}
+
+// Capacity bound RamStore size, zero fields are unlimited. The victim
+// is approximated by sampling sessions, like redis maxmemory policies.
+type Capacity struct {
+	MaxEntries int      `json:"max_entries"`
+	MaxBytes   int64    `json:"max_bytes"` // approximate memory bytes of sessions
+	Eviction   Eviction `json:"eviction"`
+}
+
+// Stats is RamStore current usage.
+type Stats struct {
+	Sessions    int
+	Bytes       int64 // approximate memory bytes of sessions, zero unless MaxBytes is set
+	Evictions   uint64
+	Expirations uint64
+}
+
+// touch record session access
+func (e *entry) touch() {
+	atomic.StoreInt64(&e.seen, time.Now().UnixNano())
+	atomic.AddInt64(&e.hits, 1)
+}
+
+// score return eviction priority, the lowest is evicted first
+func (e *entry) score(eviction Eviction) int64 {
+	if eviction == EvictionLFU {
+		return atomic.LoadInt64(&e.hits)
+	}
+	return atomic.LoadInt64(&e.seen)
+}
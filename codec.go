@@ -0,0 +1,266 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec session data serializer interface.
+// You can customize the serialization by implementing this interface.
+type Codec interface {
+	// Encode serialize value to bytes
+	Encode(v interface{}) ([]byte, error)
+	// Decode deserialize bytes to value pointer
+	Decode(data []byte, v interface{}) error
+}
+
+// record is session data serialized by codec
+type record struct {
+	CreateTime time.Time
+	ExpireTime time.Time
+	Values     Values
+	Principal  string            `json:",omitempty"`
+	Binding    map[string]string `json:",omitempty"`
+}
+
+// record return session serialized data
+func (s *Session) record() *record {
+	return &record{
+		CreateTime: s.CreateTime,
+		ExpireTime: s.ExpireTime,
+		Values:     s.Values,
+		Principal:  s.principal,
+		Binding:    s.binding,
+	}
+}
+
+// restore set session data from record
+func (s *Session) restore(r *record) {
+	s.CreateTime = r.CreateTime
+	s.ExpireTime = r.ExpireTime
+	s.Values = r.Values
+	s.principal = r.Principal
+	s.binding = r.Binding
+	if s.Values == nil {
+		s.Values = make(Values)
+	}
+}
+
+// types is registered concrete types of Values
+var types = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+}{byName: make(map[string]reflect.Type)}
+
+func init() {
+	Register(
+		false, "", []byte(nil), time.Time{},
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), []string(nil), []int(nil),
+		[]interface{}(nil), map[string]interface{}(nil),
+	)
+}
+
+// Register records concrete types stored in Values,
+// so that GobCodec and MsgpackCodec decode them back to the same Go type.
+func Register(values ...interface{}) {
+	types.Lock()
+	defer types.Unlock()
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if t == nil {
+			continue
+		}
+		name := typeName(t)
+		if _, ok := types.byName[name]; ok {
+			continue
+		}
+		types.byName[name] = t
+		gob.Register(v)
+	}
+}
+
+// typeName return package qualified type name,
+// so that same-named types from different packages do not collide.
+func typeName(t reflect.Type) string {
+	switch {
+	case t.Name() != "" && t.PkgPath() != "":
+		return t.PkgPath() + "." + t.Name()
+	case t.Name() != "":
+		return t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// lookup return registered type by name
+func lookup(name string) (reflect.Type, bool) {
+	types.RLock()
+	defer types.RUnlock()
+	t, ok := types.byName[name]
+	return t, ok
+}
+
+// JSONCodec is json serializer, the default codec.
+// Values decoded from json lose their Go types, e.g. structs become maps.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec is gob serializer, concrete types of Values must be registered by Register.
+type GobCodec struct{}
+
+func (GobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec is MessagePack serializer, values of registered types
+// are tagged with the type name and decoded back to the same Go type.
+type MsgpackCodec struct{}
+
+// msgpackValue is tagged value of Values
+type msgpackValue struct {
+	Type string             `msgpack:"t,omitempty"`
+	Data msgpack.RawMessage `msgpack:"d"`
+}
+
+// msgpackRecord is tagged session data
+type msgpackRecord struct {
+	CreateTime time.Time               `msgpack:"create_time"`
+	ExpireTime time.Time               `msgpack:"expire_time"`
+	Values     map[string]msgpackValue `msgpack:"values"`
+	Principal  string                  `msgpack:"principal,omitempty"`
+	Binding    map[string]string       `msgpack:"binding,omitempty"`
+}
+
+func (mc MsgpackCodec) Encode(v interface{}) ([]byte, error) {
+	if r, ok := v.(*record); ok {
+		tagged := msgpackRecord{
+			CreateTime: r.CreateTime,
+			ExpireTime: r.ExpireTime,
+			Values:     make(map[string]msgpackValue, len(r.Values)),
+			Principal:  r.Principal,
+			Binding:    r.Binding,
+		}
+		for key, value := range r.Values {
+			tv, err := mc.tag(value)
+			if err != nil {
+				return nil, err
+			}
+			tagged.Values[key] = tv
+		}
+		v = &tagged
+	}
+	return msgpack.Marshal(v)
+}
+
+func (mc MsgpackCodec) Decode(data []byte, v interface{}) error {
+	r, ok := v.(*record)
+	if !ok {
+		return msgpack.Unmarshal(data, v)
+	}
+	var tagged msgpackRecord
+	if err := msgpack.Unmarshal(data, &tagged); err != nil {
+		return err
+	}
+	r.CreateTime = tagged.CreateTime
+	r.ExpireTime = tagged.ExpireTime
+	r.Principal = tagged.Principal
+	r.Binding = tagged.Binding
+	r.Values = make(Values, len(tagged.Values))
+	for key, tv := range tagged.Values {
+		value, err := mc.untag(tv)
+		if err != nil {
+			return err
+		}
+		r.Values[key] = value
+	}
+	return nil
+}
+
+// tag encode value with registered type name
+func (MsgpackCodec) tag(value interface{}) (msgpackValue, error) {
+	var tv msgpackValue
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return tv, err
+	}
+	tv.Data = data
+	if t := reflect.TypeOf(value); t != nil {
+		if _, ok := lookup(typeName(t)); ok {
+			tv.Type = typeName(t)
+		}
+	}
+	return tv, nil
+}
+
+// untag decode value to registered type
+func (MsgpackCodec) untag(tv msgpackValue) (interface{}, error) {
+	t, ok := lookup(tv.Type)
+	if !ok {
+		var value interface{}
+		err := msgpack.Unmarshal(tv.Data, &value)
+		return value, err
+	}
+	if t.Kind() == reflect.Ptr {
+		ptr := reflect.New(t.Elem())
+		err := msgpack.Unmarshal(tv.Data, ptr.Interface())
+		return ptr.Interface(), err
+	}
+	ptr := reflect.New(t)
+	err := msgpack.Unmarshal(tv.Data, ptr.Interface())
+	return ptr.Elem().Interface(), err
+}
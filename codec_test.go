@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type userInfo struct {
+	UserName string
+	Age      uint8
+}
+
+// TestCodec testing codecs keep Go types of Values
+func TestCodec(t *testing.T) {
+	Register(&userInfo{}, template.HTML(""))
+
+	nowTime := time.Now().Round(time.Second)
+	want := &record{
+		CreateTime: nowTime,
+		ExpireTime: nowTime.Add(lifeTime),
+		Values: Values{
+			"user":  &userInfo{UserName: "Leon Ding", Age: 21},
+			"count": 7,
+			"html":  template.HTML("<b>gws</b>"),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"gob", GobCodec{}},
+		{"msgpack", MsgpackCodec{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Encode(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got record
+			if err := tt.codec.Decode(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.CreateTime.Equal(want.CreateTime) || !got.ExpireTime.Equal(want.ExpireTime) {
+				t.Errorf("time = %v %v, want %v %v", got.CreateTime, got.ExpireTime, want.CreateTime, want.ExpireTime)
+			}
+			if !reflect.DeepEqual(got.Values, want.Values) {
+				t.Errorf("Values = %#v, want %#v", got.Values, want.Values)
+			}
+		})
+	}
+}
+
+// TestTypeName testing registered type names are package qualified
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{&userInfo{}, "*github.com/auula/gws.userInfo"},
+		{template.HTML(""), "html/template.HTML"},
+		{[]*userInfo(nil), "[]*github.com/auula/gws.userInfo"},
+		{map[string]interface{}(nil), "map[string]interface {}"},
+		{0, "int"},
+	}
+	for _, tt := range tests {
+		if got := typeName(reflect.TypeOf(tt.value)); got != tt.want {
+			t.Errorf("typeName(%T) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
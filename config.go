@@ -25,6 +25,7 @@ package gws
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"regexp"
 	"strings"
 	"time"
@@ -99,6 +100,41 @@ var (
 		}
 	}
 
+	// WithLazyConnect set redis store start without server reachable
+	WithLazyConnect = func(lazy bool) func(*RDSOption) {
+		return func(r *RDSOption) {
+			r.LazyConnect = lazy
+		}
+	}
+
+	// WithCodec set redis session data serializer
+	WithCodec = func(codec Codec) func(*RDSOption) {
+		return func(r *RDSOption) {
+			r.Codec = codec
+		}
+	}
+
+	// WithExpiryEvents set redis store report expired sessions
+	WithExpiryEvents = func(enable bool) func(*RDSOption) {
+		return func(r *RDSOption) {
+			r.ExpiryEvents = enable
+		}
+	}
+
+	// WithConfigureEvents set redis store write notify-keyspace-events server config
+	WithConfigureEvents = func(enable bool) func(*RDSOption) {
+		return func(r *RDSOption) {
+			r.ConfigureEvents = enable
+		}
+	}
+
+	// WithEventsError set callback reporting expired keyevent notification failure
+	WithEventsError = func(fn func(err error)) func(*RDSOption) {
+		return func(r *RDSOption) {
+			r.OnEventsError = fn
+		}
+	}
+
 	// WithOpts set base option
 	WithOpts = func(opt Options) func(*RDSOption) {
 		return func(r *RDSOption) {
@@ -109,12 +145,46 @@ var (
 
 // option type is default config parameter option.
 type option struct {
-	LifeTime   time.Duration `json:"life_time"`
-	CookieName string        `json:"cookie_name"`
-	HttpOnly   bool          `json:"http_only"`
-	Path       string        `json:"path"`
-	Secure     bool          `json:"secure"`
-	Domain     string        `json:"domain"`
+	// LifeTime is absolute maximum lifetime of session
+	LifeTime time.Duration `json:"life_time"`
+	// IdleTimeout is renewed on access, zero disable sliding expiration
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	// RenewInterval is minimum extension to renew idle session,
+	// it throttles storage writes, default IdleTimeout / 10
+	RenewInterval time.Duration `json:"renew_interval"`
+	// RegenerateGrace keep old session readable after regenerate for
+	// in-flight parallel requests, zero removes it immediately
+	RegenerateGrace time.Duration `json:"regenerate_grace"`
+	CookieName      string        `json:"cookie_name"`
+	HttpOnly        bool          `json:"http_only"`
+	Path            string        `json:"path"`
+	Secure          bool          `json:"secure"`
+	Domain          string        `json:"domain"`
+	// SameSite cookie attribute, SameSiteNoneMode requires Secure
+	SameSite http.SameSite `json:"same_site"`
+	// BrowserSession omit cookie MaxAge, cookie is removed when browser closed
+	BrowserSession bool `json:"browser_session"`
+	// Partitioned cookie attribute (CHIPS), requires Secure
+	Partitioned bool `json:"partitioned"`
+	// Transport carry session token, default CookieTransport
+	Transport Transport `json:"-"`
+	// IDGenerator generate and validate session id, default RandomID
+	IDGenerator IDGenerator `json:"-"`
+	// SigningKeys sign cookie value with HMAC-SHA256, the first key signs
+	// and all keys verify, so that keys can be rotated.
+	SigningKeys [][]byte `json:"-"`
+	// MaxSessions limit concurrent sessions bound to one principal,
+	// zero is unlimited. LimitPolicy decides how Bind handles the limit.
+	MaxSessions int         `json:"max_sessions"`
+	LimitPolicy LimitPolicy `json:"limit_policy"`
+	// Binding bind session to client attributes, nil disables binding
+	Binding *Binding `json:"-"`
+	// Capacity bound RAM storage size, zero is unlimited
+	Capacity Capacity `json:"capacity"`
+	// Shards is RAM storage lock shard count, zero is default 32
+	Shards int `json:"shards"`
+	// Snapshot persist RAM storage sessions across restarts, empty path disables it
+	Snapshot Snapshot `json:"snapshot"`
 }
 
 // Options type is default config parameter option.
@@ -128,6 +198,21 @@ var (
 			o.LifeTime = d
 		}
 	}
+	WithIdleTimeout = func(d time.Duration) func(*Options) {
+		return func(o *Options) {
+			o.IdleTimeout = d
+		}
+	}
+	WithRenewInterval = func(d time.Duration) func(*Options) {
+		return func(o *Options) {
+			o.RenewInterval = d
+		}
+	}
+	WithRegenerateGrace = func(d time.Duration) func(*Options) {
+		return func(o *Options) {
+			o.RegenerateGrace = d
+		}
+	}
 	WithCookieName = func(cn string) func(*Options) {
 		return func(o *Options) {
 			o.CookieName = cn
@@ -148,6 +233,62 @@ var (
 			o.Secure = b
 		}
 	}
+	WithSameSite = func(mode http.SameSite) func(*Options) {
+		return func(o *Options) {
+			o.SameSite = mode
+		}
+	}
+	WithBrowserSession = func(b bool) func(*Options) {
+		return func(o *Options) {
+			o.BrowserSession = b
+		}
+	}
+	WithPartitioned = func(b bool) func(*Options) {
+		return func(o *Options) {
+			o.Partitioned = b
+		}
+	}
+	WithTransport = func(t Transport) func(*Options) {
+		return func(o *Options) {
+			o.Transport = t
+		}
+	}
+	WithIDGenerator = func(g IDGenerator) func(*Options) {
+		return func(o *Options) {
+			o.IDGenerator = g
+		}
+	}
+	WithSigningKeys = func(keys ...[]byte) func(*Options) {
+		return func(o *Options) {
+			o.SigningKeys = keys
+		}
+	}
+	WithMaxSessions = func(max int, policy LimitPolicy) func(*Options) {
+		return func(o *Options) {
+			o.MaxSessions = max
+			o.LimitPolicy = policy
+		}
+	}
+	WithBinding = func(b Binding) func(*Options) {
+		return func(o *Options) {
+			o.Binding = &b
+		}
+	}
+	WithCapacity = func(c Capacity) func(*Options) {
+		return func(o *Options) {
+			o.Capacity = c
+		}
+	}
+	WithShards = func(n int) func(*Options) {
+		return func(o *Options) {
+			o.Shards = n
+		}
+	}
+	WithSnapshot = func(s Snapshot) func(*Options) {
+		return func(o *Options) {
+			o.Snapshot = s
+		}
+	}
 	WithDomain = func(domain string) func(*Options) {
 		return func(o *Options) {
 			o.Domain = domain
@@ -178,11 +319,52 @@ type RDSOption struct {
 	Address  string `json:"address" `
 	Password string `json:"password" `
 	PoolSize uint8  `json:"pool_size" `
+	// LazyConnect start the store unhealthy instead of failing when
+	// the server is unreachable, it recovers once the server is reachable.
+	LazyConnect bool `json:"lazy_connect"`
+	// Codec session data serializer, default JSONCodec
+	Codec Codec `json:"-"`
+	// ExpiryEvents subscribe redis expired keyspace notifications,
+	// so that sessions expired by redis are reported to EventExpire hooks.
+	ExpiryEvents bool `json:"expiry_events"`
+	// ConfigureEvents let ExpiryEvents write the server wide notify-keyspace-events
+	// config, otherwise the server must be configured with "Ex" manually.
+	ConfigureEvents bool `json:"configure_events"`
+	// OnEventsError report expired keyevent notification is disabled or cannot be
+	// enabled, it is checked on start and whenever the server recovers.
+	OnEventsError func(err error) `json:"-"`
 }
 
 // Configure is session storage config parameter parser.
 type Configure interface {
-	Parse() (cfg *Config)
+	Parse() (cfg *Config, err error)
+}
+
+// FieldError is config parameter validation error of a field.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", fe.Field, fe.Reason)
+}
+
+// ValidationError is config parameter validation error,
+// it lists every invalid field.
+type ValidationError []*FieldError
+
+func (ve ValidationError) Error() string {
+	reasons := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		reasons = append(reasons, fe.Error())
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(reasons, "; "))
+}
+
+// add append a field error
+func (ve *ValidationError) add(field, reason string) {
+	*ve = append(*ve, &FieldError{Field: field, Reason: reason})
 }
 
 // Config is session storage config parameter.
@@ -191,7 +373,7 @@ type Config struct {
 	*RDSOption
 }
 
-func (opt *Options) Parse() (cfg *Config) {
+func (opt *Options) Parse() (cfg *Config, err error) {
 	cfg = new(Config)
 	cfg.store = def
 	cfg.RDSOption = new(RDSOption)
@@ -199,7 +381,7 @@ func (opt *Options) Parse() (cfg *Config) {
 	return verifyCfg(cfg)
 }
 
-func (opt *RAMOption) Parse() (cfg *Config) {
+func (opt *RAMOption) Parse() (cfg *Config, err error) {
 	cfg = new(Config)
 	cfg.store = ram
 	cfg.RDSOption = new(RDSOption)
@@ -207,7 +389,7 @@ func (opt *RAMOption) Parse() (cfg *Config) {
 	return verifyCfg(cfg)
 }
 
-func (opt *RDSOption) Parse() (cfg *Config) {
+func (opt *RDSOption) Parse() (cfg *Config, err error) {
 	cfg = new(Config)
 	cfg.store = rds
 	cfg.RDSOption = opt
@@ -215,20 +397,87 @@ func (opt *RDSOption) Parse() (cfg *Config) {
 }
 
 // Check the data
-func verifyCfg(cfg *Config) *Config {
+func verifyCfg(cfg *Config) (*Config, error) {
+	var ve ValidationError
+
 	// General check
 	if cfg.CookieName == "" {
-		panic("cookie name is empty.")
+		ve.add("CookieName", "is empty")
 	}
 	if cfg.Path == "" {
-		panic("domain path is empty.")
+		ve.add("Path", "is empty")
+	}
+	if cfg.SameSite == http.SameSiteNoneMode && !cfg.Secure {
+		ve.add("SameSite", "None requires Secure")
+	}
+	if cfg.Partitioned && !cfg.Secure {
+		ve.add("Partitioned", "requires Secure")
+	}
+	if strings.HasPrefix(cfg.CookieName, "__Secure-") && !cfg.Secure {
+		ve.add("CookieName", "__Secure- prefix requires Secure")
+	}
+	if strings.HasPrefix(cfg.CookieName, "__Host-") {
+		if !cfg.Secure {
+			ve.add("CookieName", "__Host- prefix requires Secure")
+		}
+		if cfg.Domain != "" {
+			ve.add("CookieName", "__Host- prefix forbids Domain")
+		}
+		if cfg.Path != "/" {
+			ve.add("CookieName", "__Host- prefix requires Path /")
+		}
 	}
 	if cfg.LifeTime <= 0 {
 		cfg.LifeTime = lifeTime
 	}
+	if cfg.IdleTimeout < 0 {
+		ve.add("IdleTimeout", "is negative")
+	}
+	if cfg.IdleTimeout > cfg.LifeTime {
+		ve.add("IdleTimeout", "is greater than LifeTime")
+	}
+	if cfg.RenewInterval <= 0 {
+		cfg.RenewInterval = cfg.IdleTimeout / 10
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = CookieTransport{}
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = RandomID{}
+	}
+	if g, ok := cfg.IDGenerator.(RandomID); ok && g.Entropy > 0 && g.Entropy < 16 {
+		ve.add("IDGenerator", "entropy is less than 16 bytes")
+	}
+	if cfg.MaxSessions < 0 {
+		ve.add("MaxSessions", "is negative")
+	}
+	if cfg.LimitPolicy > EvictLRU {
+		ve.add("LimitPolicy", "is unknown")
+	}
+	if cfg.Capacity.MaxEntries < 0 || cfg.Capacity.MaxBytes < 0 {
+		ve.add("Capacity", "is negative")
+	}
+	if cfg.Snapshot.Interval < 0 {
+		ve.add("Snapshot", "Interval is negative")
+	}
+	if cfg.Shards < 0 {
+		ve.add("Shards", "is negative")
+	}
+	if cfg.Capacity.Eviction > EvictionLFU {
+		ve.add("Capacity", "Eviction is unknown")
+	}
+	if cfg.Binding != nil {
+		cfg.Binding = cfg.Binding.validate(&ve)
+	}
+	for _, key := range cfg.SigningKeys {
+		if len(key) < 32 {
+			ve.add("SigningKeys", "key is shorter than 32 bytes")
+			break
+		}
+	}
 
 	if cfg.store == ram || cfg.store == def {
-		return cfg
+		return result(cfg, ve)
 	}
 
 	if cfg.Index > 16 {
@@ -243,19 +492,34 @@ func verifyCfg(cfg *Config) *Config {
 		cfg.Prefix = prefix
 	}
 
+	if cfg.Codec == nil {
+		cfg.Codec = JSONCodec{}
+	}
+
 	if cfg.Password == "" {
-		panic("remote server login passwd is empty.")
+		ve.add("Password", "is empty")
 	}
 
 	// Verification for specific storage
-	if net.ParseIP(strings.Split(cfg.Address, ":")[0]) == nil {
-		panic("remote ip address illegal.")
-	}
-	if matched, err := regexp.MatchString("^[0-9]*$", strings.Split(cfg.Address, ":")[1]); err == nil {
-		if !matched {
-			panic("remote server port illegal.")
+	host, port, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		ve.add("Address", "is illegal")
+	} else {
+		if net.ParseIP(host) == nil {
+			ve.add("Address", "ip is illegal")
+		}
+		if matched, _ := regexp.MatchString("^[0-9]+$", port); !matched {
+			ve.add("Address", "port is illegal")
 		}
 	}
 	debug.trace(cfg)
-	return cfg
+	return result(cfg, ve)
+}
+
+// result return config or validation error
+func result(cfg *Config, ve ValidationError) (*Config, error) {
+	if len(ve) > 0 {
+		return nil, ve
+	}
+	return cfg, nil
 }
@@ -0,0 +1,235 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	dataSuffix   = "_data" // cookie storage data cookie name suffix
+	maxChunkSize = 3800    // data cookie chunk size within browser limit
+	maxChunks    = 16      // maximum data cookie chunks
+)
+
+var (
+	ErrNoExchange     = errors.New("session has no request exchange")
+	ErrCookieTooLarge = errors.New("session data exceeds cookie limit")
+)
+
+// CookieStore client side storage, session data is serialized into
+// an AES-GCM encrypted and authenticated cookie, split into chunks
+// when the payload exceeds browser cookie limits.
+// The session must be obtained by GetSession so that the store can
+// read the request and write the response.
+type CookieStore struct {
+	aeads []cipher.AEAD
+	codec Codec
+}
+
+// NewCookieStore return cookie storage. Keys must be 16, 24 or 32 bytes,
+// the first key encrypts and all keys decrypt, so that keys can be rotated.
+// If codec is nil, JSONCodec is used.
+func NewCookieStore(codec Codec, keys ...[]byte) (*CookieStore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cookie store encryption key is empty")
+	}
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	cs := &CookieStore{codec: codec}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		cs.aeads = append(cs.aeads, aead)
+	}
+	return cs, nil
+}
+
+func (cs *CookieStore) Read(s *Session) (err error) {
+	if s.req == nil {
+		return ErrNoExchange
+	}
+	var sb strings.Builder
+	for i := 0; i < maxChunks; i++ {
+		cookie, err := s.req.Cookie(chunkName(s, i))
+		if err != nil {
+			break
+		}
+		sb.WriteString(cookie.Value)
+	}
+	if sb.Len() == 0 {
+		return ErrSessionNoData
+	}
+
+	data, err := cs.decrypt(sb.String(), s.id)
+	if err != nil {
+		debug.trace(err)
+		return ErrSessionNoData
+	}
+	var r record
+	if err := cs.codec.Decode(data, &r); err != nil {
+		return err
+	}
+	if !time.Now().Before(r.ExpireTime) {
+		return ErrSessionNoData
+	}
+	s.restore(&r)
+	debug.trace(s)
+	return nil
+}
+
+func (cs *CookieStore) Write(s *Session) (err error) {
+	if s.w == nil {
+		return ErrNoExchange
+	}
+	data, err := cs.codec.Encode(s.record())
+	if err != nil {
+		return err
+	}
+	value, err := cs.encrypt(data, s.id)
+	if err != nil {
+		return err
+	}
+
+	n := (len(value) + maxChunkSize - 1) / maxChunkSize
+	if n > maxChunks {
+		return ErrCookieTooLarge
+	}
+	for i := 0; i < n; i++ {
+		end := (i + 1) * maxChunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		cookie := s.manager().NewCookie()
+		cookie.Name = chunkName(s, i)
+		cookie.Value = value[i*maxChunkSize : end]
+		cookie.MaxAge = maxAge(s)
+		s.manager().replaceCookie(s.w, cookie)
+	}
+	// expire stale chunks of previous larger payload
+	cs.expire(s, n)
+	debug.trace(s)
+	return nil
+}
+
+func (cs *CookieStore) Remove(s *Session) (err error) {
+	if s.w == nil {
+		return ErrNoExchange
+	}
+	cs.expire(s, 0)
+	debug.trace(s)
+	return nil
+}
+
+// Regenerate overwrite data cookie with new session, the old session
+// shares the same cookie names so it must not be removed.
+func (cs *CookieStore) Regenerate(ctx context.Context, old, ns *Session, grace time.Duration) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cs.Write(ns)
+}
+
+// expire remove data cookie chunks from index
+func (cs *CookieStore) expire(s *Session, from int) {
+	if s.req == nil {
+		return
+	}
+	for i := from; i < maxChunks; i++ {
+		if _, err := s.req.Cookie(chunkName(s, i)); err != nil {
+			break
+		}
+		cookie := s.manager().NewCookie()
+		cookie.Name = chunkName(s, i)
+		cookie.MaxAge = -1
+		s.manager().replaceCookie(s.w, cookie)
+	}
+}
+
+// encrypt seal data with the first key, session id is additional data
+func (cs *CookieStore) encrypt(data []byte, id string) (string, error) {
+	aead := cs.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(id))), nil
+}
+
+// decrypt open data with all keys
+func (cs *CookieStore) decrypt(value string, id string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, aead := range cs.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if data, err := aead.Open(nil, nonce, ciphertext, []byte(id)); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("cookie data authentication failed")
+}
+
+// chunkName return data cookie chunk name
+func chunkName(s *Session, i int) string {
+	name := s.manager().cfg.CookieName + dataSuffix
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+// replaceCookie set cookie and drop earlier Set-Cookie of the same name,
+// so that writing the session twice in one request sends one cookie.
+func (m *Manager) replaceCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	header := w.Header()
+	prefix := cookie.Name + "="
+	kept := header["Set-Cookie"][:0]
+	for _, line := range header["Set-Cookie"] {
+		if !strings.HasPrefix(line, prefix) {
+			kept = append(kept, line)
+		}
+	}
+	header["Set-Cookie"] = kept
+	writeCookie(w, m.prepare(cookie))
+}
@@ -0,0 +1,101 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCookieStore testing encrypted cookie storage round trip and chunking
+func TestCookieStore(t *testing.T) {
+	oldKey := []byte(strings.Repeat("o", 32))
+	newKey := []byte(strings.Repeat("n", 32))
+
+	store, err := NewCookieStore(nil, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := NewOptions()
+	m, _ := NewManager(&opt, store)
+
+	payload := strings.Repeat("gws", 3000)
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		if r.URL.Path == "/set" {
+			s.Values["payload"] = payload
+		}
+		if r.URL.Path == "/get" && s.Values["payload"] != payload {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/set", nil))
+	cookies := w.Result().Cookies()
+	// id cookie and chunked data cookies
+	if len(cookies) < 3 {
+		t.Fatalf("cookies = %d, data not chunked", len(cookies))
+	}
+	for _, c := range cookies {
+		if len(c.Value) > maxChunkSize || strings.Contains(c.Value, "gwsgwsgws") {
+			t.Errorf("cookie %s not encrypted or chunked", c.Name)
+		}
+	}
+
+	get := func(cookies []*http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/get", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// rotate keys, data encrypted by old key still readable
+	rotated, _ := NewCookieStore(nil, newKey, oldKey)
+	m.store = rotated
+	if code := get(cookies); code != http.StatusOK {
+		t.Errorf("session data lost, code = %d", code)
+	}
+
+	// tampered data is rejected
+	tampered := make([]*http.Cookie, len(cookies))
+	for i, c := range cookies {
+		cc := *c
+		if strings.HasSuffix(cc.Name, dataSuffix) {
+			first := "A"
+			if cc.Value[0] == 'A' {
+				first = "B"
+			}
+			cc.Value = first + cc.Value[1:]
+		}
+		tampered[i] = &cc
+	}
+	if code := get(tampered); code != http.StatusNotFound {
+		t.Errorf("tampered data accepted, code = %d", code)
+	}
+}
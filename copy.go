@@ -0,0 +1,112 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"reflect"
+)
+
+// clone return shallow copy of Values, so that sessions do not share the map
+func (values Values) clone() Values {
+	dst := make(Values, len(values))
+	for key, value := range values {
+		dst[key] = value
+	}
+	return dst
+}
+
+// deepCopy return deep copy of Values, so that the new session
+// does not share maps, slices or pointers with the old session.
+func deepCopy(values Values) Values {
+	visited := make(map[uintptr]reflect.Value)
+	dst := make(Values, len(values))
+	for key, value := range values {
+		if value == nil {
+			dst[key] = nil
+			continue
+		}
+		dst[key] = copyValue(reflect.ValueOf(value), visited).Interface()
+	}
+	return dst
+}
+
+// copyValue copy value recursively, visited keeps pointer cycles
+func copyValue(src reflect.Value, visited map[uintptr]reflect.Value) reflect.Value {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return src
+		}
+		if dst, ok := visited[src.Pointer()]; ok {
+			return dst
+		}
+		dst := reflect.New(src.Type().Elem())
+		visited[src.Pointer()] = dst
+		dst.Elem().Set(copyValue(src.Elem(), visited))
+		return dst
+	case reflect.Interface:
+		if src.IsNil() {
+			return src
+		}
+		dst := reflect.New(src.Type()).Elem()
+		dst.Set(copyValue(src.Elem(), visited))
+		return dst
+	case reflect.Map:
+		if src.IsNil() {
+			return src
+		}
+		dst := reflect.MakeMapWithSize(src.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			dst.SetMapIndex(iter.Key(), copyValue(iter.Value(), visited))
+		}
+		return dst
+	case reflect.Slice:
+		if src.IsNil() {
+			return src
+		}
+		dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			dst.Index(i).Set(copyValue(src.Index(i), visited))
+		}
+		return dst
+	case reflect.Array:
+		dst := reflect.New(src.Type()).Elem()
+		for i := 0; i < src.Len(); i++ {
+			dst.Index(i).Set(copyValue(src.Index(i), visited))
+		}
+		return dst
+	case reflect.Struct:
+		// unexported fields are copied shallowly
+		dst := reflect.New(src.Type()).Elem()
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				dst.Field(i).Set(copyValue(src.Field(i), visited))
+			}
+		}
+		return dst
+	default:
+		return src
+	}
+}
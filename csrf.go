@@ -0,0 +1,246 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	csrfSecretKey = "_gws_csrf" // Values key of per-session csrf secret
+	csrfSecretLen = 32          // csrf secret bytes length
+)
+
+var (
+	ErrCSRFNoSession    = errors.New("csrf requires session middleware")
+	ErrCSRFBadOrigin    = errors.New("csrf origin not allowed")
+	ErrCSRFNoReferer    = errors.New("csrf referer missing")
+	ErrCSRFInvalidToken = errors.New("csrf token invalid")
+)
+
+// csrfReasonKey is request context key of csrf failure reason
+type csrfReasonKey struct{}
+
+// CSRFOption is csrf middleware config parameter option.
+type CSRFOption struct {
+	// FieldName is form field name of token, default csrf_token
+	FieldName string
+	// HeaderName is request header name of token, default X-CSRF-Token
+	HeaderName string
+	// TrustedOrigins is allowed origin hosts besides the request host
+	TrustedOrigins []string
+	// ExemptPaths is exact paths, or prefixes ending with *, skip checking
+	ExemptPaths []string
+	// ErrorHandler handle rejected request, default 403 Forbidden
+	ErrorHandler http.Handler
+}
+
+var (
+	WithCSRFFieldName = func(name string) func(*CSRFOption) {
+		return func(o *CSRFOption) {
+			o.FieldName = name
+		}
+	}
+	WithCSRFHeaderName = func(name string) func(*CSRFOption) {
+		return func(o *CSRFOption) {
+			o.HeaderName = name
+		}
+	}
+	WithTrustedOrigins = func(hosts ...string) func(*CSRFOption) {
+		return func(o *CSRFOption) {
+			o.TrustedOrigins = hosts
+		}
+	}
+	WithExemptPaths = func(paths ...string) func(*CSRFOption) {
+		return func(o *CSRFOption) {
+			o.ExemptPaths = paths
+		}
+	}
+	WithCSRFErrorHandler = func(h http.Handler) func(*CSRFOption) {
+		return func(o *CSRFOption) {
+			o.ErrorHandler = h
+		}
+	}
+)
+
+// CSRF validates token of unsafe method requests against the session
+// secret, it must be wrapped by session Middleware.
+func CSRF(next http.Handler, opts ...func(*CSRFOption)) http.Handler {
+	opt := CSRFOption{
+		FieldName:  "csrf_token",
+		HeaderName: "X-CSRF-Token",
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, CSRFFailureReason(r).Error(), http.StatusForbidden)
+		}),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := FromContext(r.Context())
+		if !ok {
+			opt.fail(w, r, ErrCSRFNoSession)
+			return
+		}
+		secret := csrfSecret(s)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if opt.exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := opt.checkOrigin(r); err != nil {
+			opt.fail(w, r, err)
+			return
+		}
+
+		token := r.Header.Get(opt.HeaderName)
+		if token == "" {
+			token = r.PostFormValue(opt.FieldName)
+		}
+		if !verifyToken(token, secret) {
+			opt.fail(w, r, ErrCSRFInvalidToken)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken return masked csrf token of the request session,
+// a new token is issued on every call to mitigate BREACH.
+func CSRFToken(r *http.Request) string {
+	s, ok := FromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return maskToken(csrfSecret(s))
+}
+
+// CSRFFailureReason return the reason of rejected request in ErrorHandler
+func CSRFFailureReason(r *http.Request) error {
+	if err, ok := r.Context().Value(csrfReasonKey{}).(error); ok {
+		return err
+	}
+	return nil
+}
+
+// fail call error handler with failure reason
+func (opt *CSRFOption) fail(w http.ResponseWriter, r *http.Request, err error) {
+	debug.trace(err)
+	opt.ErrorHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfReasonKey{}, err)))
+}
+
+// exempt check whether path skips checking
+func (opt *CSRFOption) exempt(path string) bool {
+	for _, p := range opt.ExemptPaths {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin check Origin or Referer host against request host and
+// trusted origins, HTTPS request without both headers is rejected.
+func (opt *CSRFOption) checkOrigin(r *http.Request) error {
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		if r.TLS != nil {
+			return ErrCSRFNoReferer
+		}
+		return nil
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return ErrCSRFBadOrigin
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, host := range opt.TrustedOrigins {
+		if strings.EqualFold(u.Host, host) {
+			return nil
+		}
+	}
+	return ErrCSRFBadOrigin
+}
+
+// csrfSecret return session csrf secret, create it if not exists
+func csrfSecret(s *Session) []byte {
+	if v, ok := s.Values[csrfSecretKey].(string); ok {
+		if secret, err := base64.RawURLEncoding.DecodeString(v); err == nil && len(secret) == csrfSecretLen {
+			return secret
+		}
+	}
+	secret := make([]byte, csrfSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err.Error())
+	}
+	s.Values[csrfSecretKey] = base64.RawURLEncoding.EncodeToString(secret)
+	s.dirty = true
+	return secret
+}
+
+// maskToken return one-time pad masked token of secret
+func maskToken(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	pad, masked := token[:len(secret)], token[len(secret):]
+	if _, err := rand.Read(pad); err != nil {
+		panic(err.Error())
+	}
+	for i := range secret {
+		masked[i] = pad[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// verifyToken unmask token and compare it with secret in constant time
+func verifyToken(token string, secret []byte) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 2*len(secret) || len(secret) == 0 {
+		return false
+	}
+	pad, masked := raw[:len(secret)], raw[len(secret):]
+	unmasked := make([]byte, len(secret))
+	for i := range secret {
+		unmasked[i] = pad[i] ^ masked[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
@@ -0,0 +1,95 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestCSRF testing csrf token and origin validation
+func TestCSRF(t *testing.T) {
+	opt := NewOptions()
+	m, _ := NewManager(&opt, NewRAM())
+
+	var token string
+	handler := m.Middleware(CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = CSRFToken(r)
+	}), WithExemptPaths("/webhook/*"), WithTrustedOrigins("admin.example.com")))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/form", nil))
+	cookie := w.Result().Cookies()[0]
+	if token == "" {
+		t.Fatal("token not issued")
+	}
+
+	post := func(path string, setup func(req *http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com"+path, nil)
+		req.AddCookie(cookie)
+		setup(req)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tampered := "A" + token[1:]
+	if tampered == token {
+		tampered = "B" + token[1:]
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		setup func(req *http.Request)
+		want  int
+	}{
+		{"header", "/save", func(req *http.Request) { req.Header.Set("X-CSRF-Token", token) }, http.StatusOK},
+		{"form", "/save", func(req *http.Request) {
+			req.Body = io.NopCloser(strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}, http.StatusOK},
+		{"missing", "/save", func(req *http.Request) {}, http.StatusForbidden},
+		{"tampered", "/save", func(req *http.Request) { req.Header.Set("X-CSRF-Token", tampered) }, http.StatusForbidden},
+		{"cross origin", "/save", func(req *http.Request) {
+			req.Header.Set("Origin", "http://evil.com")
+			req.Header.Set("X-CSRF-Token", token)
+		}, http.StatusForbidden},
+		{"trusted origin", "/save", func(req *http.Request) {
+			req.Header.Set("Origin", "https://admin.example.com")
+			req.Header.Set("X-CSRF-Token", token)
+		}, http.StatusOK},
+		{"exempt", "/webhook/github", func(req *http.Request) {}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := post(tt.path, tt.setup); code != tt.want {
+				t.Errorf("code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
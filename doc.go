@@ -31,6 +31,8 @@
 // 1. install mod
 // go get github.com/auula/gws
 // 2. Use Example Code
+// Values modified by a request are saved by Session.Sync or Middleware,
+// it is required for every storage including the default in-memory storage.
 
 // package main
 
@@ -45,7 +47,9 @@
 
 // func init() {
 
-// 	gws.Open(gws.DefaultRAMOptions)
+// 	if err := gws.Open(gws.DefaultRAMOptions); err != nil {
+// 		log.Fatal(err)
+// 	}
 
 // }
 
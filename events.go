@@ -0,0 +1,163 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"sync"
+)
+
+// EventType is session lifecycle event type.
+type EventType uint8
+
+const (
+	EventCreate     EventType = iota // Session is created by GetSession
+	EventRead                        // Session is read by GetSession
+	EventSave                        // Session is saved by Sync
+	EventMigrate                     // Session id is regenerated by Migrate or Regenerate
+	EventInvalidate                  // Session is removed by Invalidate
+	EventExpire                      // Session is expired, found by GetSession or the storage
+	EventEvict                       // Session is evicted by storage limit
+)
+
+// String return event type name
+func (t EventType) String() string {
+	switch t {
+	case EventCreate:
+		return "create"
+	case EventRead:
+		return "read"
+	case EventSave:
+		return "save"
+	case EventMigrate:
+		return "migrate"
+	case EventInvalidate:
+		return "invalidate"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is session lifecycle event passed to hooks.
+type Event struct {
+	Type EventType
+	// Session is a snapshot with deep copied values, modifying it does not
+	// change the live session. Sessions expired by redis carry the full
+	// record claimed through the shadow key when ExpiryEvents is enabled.
+	Session *Session
+	// OldID is the previous session id of EventMigrate
+	OldID string
+}
+
+// Hook is session lifecycle event callback, hooks are called synchronously
+// on the request goroutine or the storage expiry goroutine.
+type Hook func(ctx context.Context, e *Event)
+
+// ExpiryNotifier storage which reports sessions expired by the storage itself.
+type ExpiryNotifier interface {
+	// OnExpire register callback called with expired session
+	OnExpire(fn func(s *Session))
+}
+
+// EvictionNotifier storage which reports sessions evicted by its capacity.
+type EvictionNotifier interface {
+	// OnEvict register callback called with evicted session
+	OnEvict(fn func(s *Session))
+}
+
+// hooks is registered hooks by event type
+type hooks struct {
+	rw     sync.RWMutex
+	byType map[EventType][]Hook
+}
+
+// On register hook called when event of the type happens
+func (m *Manager) On(t EventType, hook Hook) {
+	m.hooks.rw.Lock()
+	defer m.hooks.rw.Unlock()
+	if m.hooks.byType == nil {
+		m.hooks.byType = make(map[EventType][]Hook)
+	}
+	m.hooks.byType[t] = append(m.hooks.byType[t], hook)
+}
+
+// On register hook of default manager
+func On(t EventType, hook Hook) {
+	std.On(t, hook)
+}
+
+// adopt register hooks of the old manager, so that hooks registered
+// on the default manager survive Open and StoreFactory
+func (m *Manager) adopt(old *Manager) {
+	old.hooks.rw.RLock()
+	defer old.hooks.rw.RUnlock()
+	for t, registered := range old.hooks.byType {
+		for _, hook := range registered {
+			m.On(t, hook)
+		}
+	}
+}
+
+// emit call hooks of the event type with session snapshot,
+// the snapshot is only made when hooks are registered.
+func (m *Manager) emit(ctx context.Context, t EventType, s *Session, oldID string) {
+	m.hooks.rw.RLock()
+	registered := m.hooks.byType[t]
+	m.hooks.rw.RUnlock()
+	if len(registered) == 0 {
+		return
+	}
+	e := &Event{Type: t, Session: s.snapshot(), OldID: oldID}
+	debug.trace(e)
+	for _, hook := range registered {
+		hook(ctx, e)
+	}
+}
+
+// listening return whether hooks of the event type are registered
+func (m *Manager) listening(t EventType) bool {
+	m.hooks.rw.RLock()
+	defer m.hooks.rw.RUnlock()
+	return len(m.hooks.byType[t]) > 0
+}
+
+// snapshot return session copy with deep copied values
+func (s *Session) snapshot() *Session {
+	cp := &Session{
+		session: session{
+			id:         s.id,
+			m:          s.m,
+			removed:    s.removed,
+			principal:  s.principal,
+			binding:    s.binding,
+			CreateTime: s.CreateTime,
+			ExpireTime: s.ExpireTime,
+		},
+	}
+	cp.Values = deepCopy(s.Values)
+	return cp
+}
@@ -0,0 +1,115 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHooks testing session lifecycle event hooks
+func TestHooks(t *testing.T) {
+	opt := NewOptions(WithLifeTime(100 * time.Millisecond))
+	m, _ := NewManager(&opt, NewRAM())
+
+	var mu sync.Mutex
+	var got []EventType
+	events := make(chan *Event, 16)
+	for _, typ := range []EventType{EventCreate, EventRead, EventSave, EventMigrate, EventInvalidate, EventExpire} {
+		m.On(typ, func(ctx context.Context, e *Event) {
+			mu.Lock()
+			got = append(got, e.Type)
+			mu.Unlock()
+			events <- e
+		})
+	}
+
+	w := httptest.NewRecorder()
+	s, _ := m.GetSession(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	s.Values["user"] = "leon"
+	_ = s.Sync()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	s, _ = m.GetSession(httptest.NewRecorder(), req)
+
+	ns, _ := m.Regenerate(httptest.NewRecorder(), s)
+	for e := range events {
+		if e.Type != EventMigrate {
+			continue
+		}
+		if e.OldID != s.ID() || e.Session.ID() != ns.ID() {
+			t.Errorf("migrate event ids = %s -> %s", e.OldID, e.Session.ID())
+		}
+		// snapshot does not share values with the live session
+		e.Session.Values["user"] = "ding"
+		if ns.Values["user"] != "leon" {
+			t.Error("snapshot shares values")
+		}
+		break
+	}
+	_ = m.Invalidate(ns)
+
+	// session expired by storage gc
+	expired := m.NewSession()
+	_ = expired.Sync()
+	deadline := time.After(3 * time.Second)
+	for done := false; !done; {
+		select {
+		case e := <-events:
+			done = e.Type == EventExpire && e.Session.ID() == expired.ID()
+		case <-deadline:
+			t.Fatal("expire event not fired")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []EventType{EventCreate, EventSave, EventRead, EventMigrate, EventInvalidate, EventSave, EventExpire}
+	if !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+// TestDefaultHooks testing hooks of default manager survive Open
+func TestDefaultHooks(t *testing.T) {
+	std = new(Manager)
+	var created int
+	On(EventCreate, func(ctx context.Context, e *Event) {
+		created++
+	})
+	if err := Open(DefaultRAMOptions); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if _, err := GetSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Errorf("create hook fired %d times, want 1", created)
+	}
+}
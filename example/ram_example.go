@@ -28,6 +28,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"sync"
 	"time"
@@ -44,7 +45,9 @@ func init() {
 	// gws.Open(gws.NewOptions())
 	// gws.Open(gws.NewOptions(gws.Domain(""), gws.CookieName("")))
 
-	gws.Open(gws.DefaultRAMOptions)
+	if err := gws.Open(gws.DefaultRAMOptions); err != nil {
+		log.Fatal(err)
+	}
 
 }
 
@@ -119,12 +122,15 @@ func main() {
 			}()
 		}
 		wg.Wait()
+		// every storage keeps a copy of Values, sync the result
+		session.Sync()
 		fmt.Fprintln(writer, session.Values["count"].(int))
 	})
 
 	http.HandleFunc("/result", func(writer http.ResponseWriter, request *http.Request) {
 		session, _ := gws.GetSession(writer, request)
-		fmt.Fprintln(writer, session.Values["count"].(int))
+		count, _ := session.Values["count"].(int)
+		fmt.Fprintln(writer, count)
 	})
 
 	http.HandleFunc("/clean", func(rw http.ResponseWriter, request *http.Request) {
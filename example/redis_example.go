@@ -36,7 +36,9 @@ import (
 
 func init() {
 	gws.Debug(true)
-	gws.Open(gws.NewRDSOptions("127.0.0.1", 6379, "redis.nosql"))
+	if err := gws.Open(gws.NewRDSOptions("127.0.0.1", 6379, "redis.nosql")); err != nil {
+		log.Fatal(err)
+	}
 }
 
 type UserInfo struct {
@@ -27,6 +27,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/auula/gws"
@@ -34,7 +35,9 @@ import (
 
 func init() {
 	gws.Debug(false)
-	gws.StoreFactory(gws.NewOptions(), &FileStore{})
+	if err := gws.StoreFactory(gws.NewOptions(), &FileStore{}); err != nil {
+		log.Fatal(err)
+	}
 }
 
 type FileStore struct{}
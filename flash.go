@@ -0,0 +1,85 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+// flashPrefix is Values key prefix of flash messages
+const flashPrefix = "_gws_flash:"
+
+// AddFlash add one-shot message of the category, it is persisted
+// by the normal Sync path and consumed by Flashes.
+func (s *Session) AddFlash(category string, msg interface{}) {
+	key := flashPrefix + category
+	msgs := s.flashes(key)
+	// never append into backing array of a read messages slice
+	s.Values[key] = append(msgs[:len(msgs):len(msgs)], msg)
+	s.dirty = true
+}
+
+// Flashes return and consume messages of the category,
+// reading flashes marks the session modified.
+func (s *Session) Flashes(category string) []interface{} {
+	key := flashPrefix + category
+	msgs := s.flashes(key)
+	if _, ok := s.Values[key]; ok {
+		delete(s.Values, key)
+		s.dirty = true
+	}
+	return msgs
+}
+
+// flashes return messages of the key, messages decoded by
+// a codec that loses Go types are converted through the codec.
+func (s *Session) flashes(key string) []interface{} {
+	switch v := s.Values[key].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		var msgs []interface{}
+		if err := convert(s.manager().codec(), v, &msgs); err != nil {
+			debug.trace(err)
+			return nil
+		}
+		return msgs
+	}
+}
+
+// FlashesOf return and consume typed messages of the category,
+// messages which cannot be converted to T are dropped.
+func FlashesOf[T any](s *Session, category string) []T {
+	var msgs []T
+	for _, v := range s.Flashes(category) {
+		if t, ok := v.(T); ok {
+			msgs = append(msgs, t)
+			continue
+		}
+		var t T
+		if err := convert(s.manager().codec(), v, &t); err != nil {
+			debug.trace(err)
+			continue
+		}
+		msgs = append(msgs, t)
+	}
+	return msgs
+}
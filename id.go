@@ -0,0 +1,87 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+)
+
+// defaultEntropy is default random bytes length of session id
+const defaultEntropy = 32
+
+// IDGenerator session id generator interface.
+// You can customize the session id by implementing this interface.
+type IDGenerator interface {
+	// Generate return new session id
+	Generate() string
+	// Validate check whether the id is well-formed,
+	// malformed id is rejected before reading the storage.
+	Validate(id string) bool
+}
+
+// RandomID generate session id from crypto/rand with URL-safe encoding.
+type RandomID struct {
+	// Entropy is random bytes length, default 32
+	Entropy int
+}
+
+// entropy return random bytes length
+func (r RandomID) entropy() int {
+	if r.Entropy <= 0 {
+		return defaultEntropy
+	}
+	return r.Entropy
+}
+
+func (r RandomID) Generate() string {
+	b := make([]byte, r.entropy())
+	if _, err := rand.Read(b); err != nil {
+		panic(err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (r RandomID) Validate(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(r.entropy()) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil
+}
+
+// uuid73Pattern is two joined UUIDv4 strings
+var uuid73Pattern = regexp.MustCompile(`^([0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12})-([0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12})$`)
+
+// LegacyUUID generate session id of two joined UUIDv4 strings,
+// it keeps session id compatible with previous versions.
+type LegacyUUID struct{}
+
+func (LegacyUUID) Generate() string {
+	return uuid73()
+}
+
+func (LegacyUUID) Validate(id string) bool {
+	return uuid73Pattern.MatchString(id)
+}
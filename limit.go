@@ -0,0 +1,205 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrSessionLimit     = errors.New("session limit of principal reached")
+	ErrLimitUnsupported = errors.New("storage does not support session limit")
+)
+
+// LimitPolicy decide how to bind a session when the principal
+// already holds MaxSessions sessions.
+type LimitPolicy uint8
+
+const (
+	RejectNew   LimitPolicy = iota // Reject the new session with ErrSessionLimit
+	EvictOldest                    // Evict the earliest created session
+	EvictLRU                       // Evict the least recently used session
+)
+
+// String return policy name used by config and redis script
+func (p LimitPolicy) String() string {
+	switch p {
+	case EvictOldest:
+		return "evict_oldest"
+	case EvictLRU:
+		return "evict_lru"
+	default:
+		return "reject"
+	}
+}
+
+// parseLimitPolicy parse policy name
+func parseLimitPolicy(name string) (LimitPolicy, bool) {
+	for _, p := range []LimitPolicy{RejectNew, EvictOldest, EvictLRU} {
+		if strings.EqualFold(name, p.String()) {
+			return p, true
+		}
+	}
+	return RejectNew, false
+}
+
+// SessionLimiter storage which limits concurrent sessions of principal atomically.
+type SessionLimiter interface {
+	// BindLimit write session bound to its principal, if the principal already
+	// holds max sessions, it is rejected or others are evicted by policy.
+	BindLimit(ctx context.Context, s *Session, max int, policy LimitPolicy) (evicted []string, err error)
+}
+
+// BindLimit count, evict and write session under one lock
+func (ram *RamStore) BindLimit(ctx context.Context, s *Session, max int, policy LimitPolicy) (evicted []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ram.lockAll()
+	ids := ram.userSessions(s.principal)
+	count := len(ids)
+	if sh := ram.shardOf(s.id); sh.store[s.id] == nil || sh.store[s.id].s.principal != s.principal {
+		count++
+	}
+	if count > max {
+		if policy == RejectNew {
+			ram.unlockAll()
+			return nil, ErrSessionLimit
+		}
+		victims := make([]*entry, 0, len(ids))
+		for _, sid := range ids {
+			if sid != s.id {
+				victims = append(victims, ram.shardOf(sid).store[sid])
+			}
+		}
+		sort.Slice(victims, func(i, j int) bool {
+			if policy == EvictLRU {
+				return atomic.LoadInt64(&victims[i].seen) < atomic.LoadInt64(&victims[j].seen)
+			}
+			return victims[i].s.CreateTime.Before(victims[j].s.CreateTime)
+		})
+		for _, e := range victims[:count-max] {
+			evicted = append(evicted, e.s.id)
+			ram.drop(ram.shardOf(e.s.id), e.s.id)
+		}
+	}
+	ram.put(ram.shardOf(s.id), s)
+	ram.unlockAll()
+	ram.shrink(s.id)
+	debug.trace(s, evicted)
+	return evicted, nil
+}
+
+// bindLimitScript prune expired ids, reject or evict by policy and write session,
+// KEYS: session key, index key, seen key, shadow key;
+// ARGV: data, ttl ms, session id, create time ms, now ms, max, policy, session key prefix,
+// live key prefix, shadow margin ms.
+var bindLimitScript = redis.NewScript(`
+for _, id in ipairs(redis.call('ZRANGE', KEYS[2], 0, -1)) do
+	if redis.call('EXISTS', ARGV[9] .. id) == 0 then
+		redis.call('ZREM', KEYS[2], id)
+		redis.call('ZREM', KEYS[3], id)
+	end
+end
+local count = redis.call('ZCARD', KEYS[2])
+if not redis.call('ZSCORE', KEYS[2], ARGV[3]) then
+	count = count + 1
+end
+local max = tonumber(ARGV[6])
+local evicted = {}
+if count > max then
+	if ARGV[7] == 'reject' then
+		return false
+	end
+	local order = KEYS[2]
+	if ARGV[7] == 'evict_lru' then
+		order = KEYS[3]
+	end
+	for _, id in ipairs(redis.call('ZRANGE', order, 0, -1)) do
+		if count <= max then
+			break
+		end
+		if id ~= ARGV[3] then
+			redis.call('DEL', ARGV[8] .. id, ARGV[9] .. id)
+			redis.call('ZREM', KEYS[2], id)
+			redis.call('ZREM', KEYS[3], id)
+			table.insert(evicted, id)
+			count = count - 1
+		end
+	end
+end
+local margin = tonumber(ARGV[10])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', tonumber(ARGV[2]) + margin)
+if margin > 0 then
+	redis.call('SET', KEYS[4], '', 'PX', ARGV[2])
+end
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[5], ARGV[3])
+for i = 2, 3 do
+	if redis.call('PTTL', KEYS[i]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	end
+end
+return evicted
+`)
+
+// BindLimit count, evict and write session by one script
+func (rds *RdsStore) BindLimit(ctx context.Context, s *Session, max int, policy LimitPolicy) (evicted []string, err error) {
+	ttl := expire(s.ExpireTime)
+	if ttl.Milliseconds() <= 0 {
+		return nil, ErrSessionNoData
+	}
+	bytes, err := rds.codec.Encode(s.record())
+	if err != nil {
+		return nil, err
+	}
+	timeout, cancelFunc := timeoutCtx(ctx)
+	rds.rw.Lock()
+	defer func() {
+		cancelFunc()
+		rds.rw.Unlock()
+	}()
+	keys := []string{rds.formatPrefix(s.id), rds.formatIndex(s.principal), rds.formatSeen(s.principal), rds.formatShadow(s.id)}
+	args := []interface{}{
+		bytes, ttl.Milliseconds(), s.id, s.CreateTime.UnixMilli(),
+		time.Now().UnixMilli(), max, policy.String(), rds.formatPrefix(""),
+		rds.livePrefix(), rds.margin().Milliseconds(),
+	}
+	evicted, err = bindLimitScript.Run(timeout, rds.store, keys, args...).StringSlice()
+	if err == redis.Nil {
+		rds.report(nil)
+		return nil, ErrSessionLimit
+	}
+	debug.trace(s, evicted)
+	if err = rds.report(err); err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
@@ -0,0 +1,366 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is environment variables prefix
+const envPrefix = "GWS_"
+
+// source is config file and environment variables layout,
+// an empty or nil field is not set and keeps the default value.
+// Environment variable name is GWS_ with upper json tag, e.g. GWS_COOKIE_NAME.
+type source struct {
+	Store           string   `json:"store" yaml:"store"`
+	LifeTime        duration `json:"life_time" yaml:"life_time"`
+	IdleTimeout     duration `json:"idle_timeout" yaml:"idle_timeout"`
+	RenewInterval   duration `json:"renew_interval" yaml:"renew_interval"`
+	RegenerateGrace duration `json:"regenerate_grace" yaml:"regenerate_grace"`
+	CookieName      string   `json:"cookie_name" yaml:"cookie_name"`
+	HttpOnly        *bool    `json:"http_only" yaml:"http_only"`
+	Path            string   `json:"path" yaml:"path"`
+	Secure          *bool    `json:"secure" yaml:"secure"`
+	Domain          string   `json:"domain" yaml:"domain"`
+	SameSite        string   `json:"same_site" yaml:"same_site"`
+	BrowserSession  *bool    `json:"browser_session" yaml:"browser_session"`
+	Partitioned     *bool    `json:"partitioned" yaml:"partitioned"`
+	MaxSessions     *int     `json:"max_sessions" yaml:"max_sessions"`
+	LimitPolicy     string   `json:"limit_policy" yaml:"limit_policy"`
+	MaxEntries      *int     `json:"max_entries" yaml:"max_entries"`
+	MaxBytes        *int64   `json:"max_bytes" yaml:"max_bytes"`
+	Eviction        string   `json:"eviction" yaml:"eviction"`
+	Shards          *int     `json:"shards" yaml:"shards"`
+	SnapshotPath    string   `json:"snapshot_path" yaml:"snapshot_path"`
+	SnapshotEvery   duration `json:"snapshot_interval" yaml:"snapshot_interval"`
+	Index           *uint8   `json:"db_index" yaml:"db_index"`
+	Prefix          string   `json:"prefix" yaml:"prefix"`
+	Address         string   `json:"address" yaml:"address"`
+	Password        string   `json:"password" yaml:"password"`
+	PasswordFile    string   `json:"password_file" yaml:"password_file"`
+	PoolSize        *uint8   `json:"pool_size" yaml:"pool_size"`
+	LazyConnect     *bool    `json:"lazy_connect" yaml:"lazy_connect"`
+	Codec           string   `json:"codec" yaml:"codec"`
+	ExpiryEvents    *bool    `json:"expiry_events" yaml:"expiry_events"`
+	ConfigureEvents *bool    `json:"configure_events" yaml:"configure_events"`
+}
+
+// LoadFile return validated Configure from JSON or YAML file.
+func LoadFile(path string) (Configure, error) {
+	var src source
+	if err := src.file(path); err != nil {
+		return nil, err
+	}
+	return src.configure()
+}
+
+// LoadEnv return validated Configure from GWS_* environment variables.
+func LoadEnv() (Configure, error) {
+	var src source
+	if err := src.env(); err != nil {
+		return nil, err
+	}
+	return src.configure()
+}
+
+// Load return validated Configure from file layered with environment variables,
+// environment variables take precedence. If path is empty only environment is loaded.
+func Load(path string) (Configure, error) {
+	var src source
+	if path != "" {
+		if err := src.file(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := src.env(); err != nil {
+		return nil, err
+	}
+	return src.configure()
+}
+
+// file decode config file by extension
+func (src *source) file(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, src)
+	case ".json":
+		err = json.Unmarshal(data, src)
+	default:
+		return fmt.Errorf("unsupported config file: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// env override fields with environment variables
+func (src *source) env() error {
+	v := reflect.ValueOf(src).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envPrefix + strings.ToUpper(t.Field(i).Tag.Get("json"))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	// environment password overrides password file from config file
+	if _, ok := os.LookupEnv(envPrefix + "PASSWORD"); ok {
+		if _, ok := os.LookupEnv(envPrefix + "PASSWORD_FILE"); !ok {
+			src.PasswordFile = ""
+		}
+	}
+	return nil
+}
+
+// duration is config duration, either a string like "30m" or a number of seconds
+type duration string
+
+// UnmarshalJSON accept JSON string or number
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*d = duration(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be string or number: %s", data)
+	}
+	*d = duration(s)
+	return nil
+}
+
+// setField set field value from string
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	// pointer field
+	elem := reflect.New(field.Type().Elem())
+	switch elem.Elem().Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetBool(b)
+	case reflect.Uint8:
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetUint(n)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, elem.Elem().Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetInt(n)
+	}
+	field.Set(elem)
+	return nil
+}
+
+// configure build validated Configure from source
+func (src *source) configure() (Configure, error) {
+	base := NewOptions()
+	if err := src.apply(&base.option); err != nil {
+		return nil, err
+	}
+
+	var opt Configure
+	switch strings.ToLower(src.Store) {
+	case "", "ram":
+		opt = &RAMOption{option: base.option}
+	case "redis", "rds":
+		rdsopt := NewRDSOptions("", 0, "", WithOpts(base))
+		rdsopt.Address = src.Address
+		if err := src.redis(rdsopt); err != nil {
+			return nil, err
+		}
+		opt = rdsopt
+	default:
+		return nil, fmt.Errorf("unsupported store: %s", src.Store)
+	}
+
+	if _, err := opt.Parse(); err != nil {
+		return nil, err
+	}
+	return opt, nil
+}
+
+// apply set general option fields
+func (src *source) apply(opt *option) error {
+	for _, d := range []struct {
+		name  string
+		value duration
+		field *time.Duration
+	}{
+		{"life_time", src.LifeTime, &opt.LifeTime},
+		{"idle_timeout", src.IdleTimeout, &opt.IdleTimeout},
+		{"renew_interval", src.RenewInterval, &opt.RenewInterval},
+		{"regenerate_grace", src.RegenerateGrace, &opt.RegenerateGrace},
+		{"snapshot_interval", src.SnapshotEvery, &opt.Snapshot.Interval},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := parseDuration(string(d.value))
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.name, err)
+		}
+		*d.field = v
+	}
+	if src.CookieName != "" {
+		opt.CookieName = src.CookieName
+	}
+	if src.HttpOnly != nil {
+		opt.HttpOnly = *src.HttpOnly
+	}
+	if src.Path != "" {
+		opt.Path = src.Path
+	}
+	if src.Secure != nil {
+		opt.Secure = *src.Secure
+	}
+	if src.Domain != "" {
+		opt.Domain = src.Domain
+	}
+	switch strings.ToLower(src.SameSite) {
+	case "":
+	case "lax":
+		opt.SameSite = http.SameSiteLaxMode
+	case "strict":
+		opt.SameSite = http.SameSiteStrictMode
+	case "none":
+		opt.SameSite = http.SameSiteNoneMode
+	default:
+		return fmt.Errorf("unsupported same_site: %s", src.SameSite)
+	}
+	if src.BrowserSession != nil {
+		opt.BrowserSession = *src.BrowserSession
+	}
+	if src.Partitioned != nil {
+		opt.Partitioned = *src.Partitioned
+	}
+	if src.MaxSessions != nil {
+		opt.MaxSessions = *src.MaxSessions
+	}
+	if src.LimitPolicy != "" {
+		policy, ok := parseLimitPolicy(src.LimitPolicy)
+		if !ok {
+			return fmt.Errorf("unsupported limit_policy: %s", src.LimitPolicy)
+		}
+		opt.LimitPolicy = policy
+	}
+	if src.MaxEntries != nil {
+		opt.Capacity.MaxEntries = *src.MaxEntries
+	}
+	if src.MaxBytes != nil {
+		opt.Capacity.MaxBytes = *src.MaxBytes
+	}
+	if src.SnapshotPath != "" {
+		opt.Snapshot.Path = src.SnapshotPath
+	}
+	if src.Shards != nil {
+		opt.Shards = *src.Shards
+	}
+	switch strings.ToLower(src.Eviction) {
+	case "", "lru":
+	case "lfu":
+		opt.Capacity.Eviction = EvictionLFU
+	default:
+		return fmt.Errorf("unsupported eviction: %s", src.Eviction)
+	}
+	return nil
+}
+
+// redis set redis option fields, password file takes precedence over password of the same layer
+func (src *source) redis(opt *RDSOption) error {
+	if src.Index != nil {
+		opt.Index = *src.Index
+	}
+	if src.Prefix != "" {
+		opt.Prefix = src.Prefix
+	}
+	if src.PoolSize != nil {
+		opt.PoolSize = *src.PoolSize
+	}
+	if src.LazyConnect != nil {
+		opt.LazyConnect = *src.LazyConnect
+	}
+	if src.ExpiryEvents != nil {
+		opt.ExpiryEvents = *src.ExpiryEvents
+	}
+	if src.ConfigureEvents != nil {
+		opt.ConfigureEvents = *src.ConfigureEvents
+	}
+	switch strings.ToLower(src.Codec) {
+	case "", "json":
+		opt.Codec = JSONCodec{}
+	case "gob":
+		opt.Codec = GobCodec{}
+	case "msgpack":
+		opt.Codec = MsgpackCodec{}
+	default:
+		return fmt.Errorf("unsupported codec: %s", src.Codec)
+	}
+	opt.Password = src.Password
+	if src.PasswordFile != "" {
+		secret, err := os.ReadFile(src.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("password_file: %w", err)
+		}
+		opt.Password = strings.TrimSpace(string(secret))
+	}
+	return nil
+}
+
+// parseDuration parse human readable duration, a bare number is seconds
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
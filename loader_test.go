@@ -0,0 +1,102 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoad testing config file layered with environment variables
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("redis.nosql\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "gws.yaml")
+	data := "store: redis\nlife_time: 45m\ncookie_name: sid\naddress: 127.0.0.1:6379\npassword_file: " + secret + "\nlimit_policy: evict_lru\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GWS_COOKIE_NAME", "env_sid")
+	os.Setenv("GWS_DB_INDEX", "3")
+	os.Setenv("GWS_MAX_SESSIONS", "5")
+	defer os.Unsetenv("GWS_COOKIE_NAME")
+	defer os.Unsetenv("GWS_DB_INDEX")
+	defer os.Unsetenv("GWS_MAX_SESSIONS")
+
+	opt, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := opt.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.store != rds {
+		t.Errorf("store = %v, want rds", cfg.store)
+	}
+	if cfg.LifeTime != 45*time.Minute {
+		t.Errorf("LifeTime = %v, want 45m", cfg.LifeTime)
+	}
+	if cfg.CookieName != "env_sid" || cfg.Index != 3 {
+		t.Errorf("environment not layered: %s %d", cfg.CookieName, cfg.Index)
+	}
+	if cfg.MaxSessions != 5 || cfg.LimitPolicy != EvictLRU {
+		t.Errorf("session limit = %d %v, want 5 evict_lru", cfg.MaxSessions, cfg.LimitPolicy)
+	}
+	if cfg.Password != "redis.nosql" {
+		t.Errorf("Password = %q, want from file", cfg.Password)
+	}
+
+	os.Setenv("GWS_PASSWORD", "env.nosql")
+	opt, err = Load(path)
+	os.Unsetenv("GWS_PASSWORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ = opt.Parse(); cfg.Password != "env.nosql" {
+		t.Errorf("Password = %q, want from environment", cfg.Password)
+	}
+
+	jsonPath := filepath.Join(dir, "gws.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"life_time": 1800, "idle_timeout": "10m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if opt, err = LoadFile(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ = opt.Parse(); cfg.LifeTime != 30*time.Minute || cfg.IdleTimeout != 10*time.Minute {
+		t.Errorf("json durations = %v %v, want 30m 10m", cfg.LifeTime, cfg.IdleTimeout)
+	}
+
+	os.Setenv("GWS_ADDRESS", "localhost")
+	defer os.Unsetenv("GWS_ADDRESS")
+	if _, err := Load(path); err == nil {
+		t.Error("Load() should return validation error")
+	}
+}
@@ -0,0 +1,467 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Manager is session manager, it holds the config parameter and storage,
+// so that multiple independent sessions can run in one process.
+type Manager struct {
+	cfg   *Config
+	store Storage
+	hooks hooks
+}
+
+// NewManager return session manager from config and storage.
+// If store is nil, the storage is created by config store type.
+func NewManager(opt Configure, store Storage) (*Manager, error) {
+	debug.trace(opt)
+	cfg, err := opt.Parse()
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{cfg: cfg}
+	if store == nil {
+		if store, err = m.newStore(); err != nil {
+			return nil, err
+		}
+	}
+	m.store = store
+	if en, ok := store.(ExpiryNotifier); ok {
+		en.OnExpire(func(s *Session) {
+			m.emit(context.Background(), EventExpire, s, "")
+		})
+	}
+	if en, ok := store.(EvictionNotifier); ok {
+		en.OnEvict(func(s *Session) {
+			m.emit(context.Background(), EventEvict, s, "")
+		})
+	}
+	return m, nil
+}
+
+// newStore create storage by config store type
+func (m *Manager) newStore() (Storage, error) {
+	switch m.cfg.store {
+	case rds:
+		rdb := NewRdsStore(m.cfg.RDSOption)
+		timeout, cancelFunc := timeoutCtx(context.Background())
+		defer cancelFunc()
+		if err := rdb.store.Ping(timeout).Err(); err != nil {
+			if !m.cfg.LazyConnect {
+				_ = rdb.Close()
+				return nil, err
+			}
+			debug.trace(err)
+			rdb.unhealthy()
+			return rdb, nil
+		}
+		// opt-in server config must be applied when the server is reachable
+		if m.cfg.ConfigureEvents && m.cfg.ExpiryEvents {
+			if err := rdb.enableNotify(timeout); err != nil {
+				_ = rdb.Close()
+				return nil, err
+			}
+		}
+		return rdb, nil
+	default:
+		return NewRAM(
+			WithRAMShards(m.cfg.Shards),
+			WithRAMCapacity(m.cfg.Capacity),
+			WithRAMSnapshot(m.cfg.Snapshot),
+		), nil
+	}
+}
+
+// cs return context storage of the manager storage
+func (m *Manager) cs() ContextStorage {
+	return ContextAdapter(m.store)
+}
+
+// Config return manager config parameter
+func (m *Manager) Config() *Config {
+	return m.cfg
+}
+
+// Storage return manager session storage
+func (m *Manager) Storage() Storage {
+	return m.store
+}
+
+// Close close the session storage if it is closable,
+// e.g. stop RamStore expiry scheduler or close redis client.
+func (m *Manager) Close() error {
+	if c, ok := m.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// codec return the session store codec
+func (m *Manager) codec() Codec {
+	if m.cfg != nil && m.cfg.RDSOption != nil && m.cfg.Codec != nil {
+		return m.cfg.Codec
+	}
+	return JSONCodec{}
+}
+
+// GetSession Get session data from the Request
+func (m *Manager) GetSession(w http.ResponseWriter, req *http.Request) (*Session, error) {
+	return m.GetSessionContext(req.Context(), w, req)
+}
+
+// GetSessionContext Get session data from the Request with context
+func (m *Manager) GetSessionContext(ctx context.Context, w http.ResponseWriter, req *http.Request) (*Session, error) {
+	var session Session
+	session.m = m
+	session.w, session.req = w, req
+
+	value, ok := m.cfg.Transport.Extract(req, m.cfg.CookieName)
+	if !ok {
+		debug.trace(req)
+		return m.createSession(ctx, w, req)
+	}
+
+	// reject tampered or malformed id before reading the storage
+	id, ok := m.decodeValue(value)
+	if !ok || !m.cfg.IDGenerator.Validate(id) {
+		debug.trace(value)
+		return m.createSession(ctx, w, req)
+	}
+
+	session.id = id
+	if m.cs().ReadContext(ctx, &session) != nil {
+		return m.createSession(ctx, w, req)
+	}
+	if session.Expired() {
+		debug.trace(&session)
+		_ = m.cs().RemoveContext(ctx, &session)
+		m.emit(ctx, EventExpire, &session, "")
+		return m.createSession(ctx, w, req)
+	}
+	attr, bound, ok := m.cfg.Binding.verify(&session, req)
+	if !ok {
+		return m.mismatch(ctx, w, req, &session, attr)
+	}
+	if bound {
+		if err := m.cs().WriteContext(ctx, &session); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.renew(ctx, w, &session); err != nil {
+		return nil, err
+	}
+
+	debug.trace(&session)
+	m.emit(ctx, EventRead, &session, "")
+	return &session, nil
+}
+
+// Migrate migrate old session data to new session, it is Regenerate
+func (m *Manager) Migrate(write http.ResponseWriter, old *Session) (*Session, error) {
+	return m.RegenerateContext(context.Background(), write, old)
+}
+
+// MigrateContext migrate old session data to new session with context
+func (m *Manager) MigrateContext(ctx context.Context, write http.ResponseWriter, old *Session) (*Session, error) {
+	return m.RegenerateContext(ctx, write, old)
+}
+
+// Regenerate regenerate session id with deep copied values, the old
+// session is removed or stays readable for RegenerateGrace.
+func (m *Manager) Regenerate(write http.ResponseWriter, old *Session) (*Session, error) {
+	return m.RegenerateContext(context.Background(), write, old)
+}
+
+// RegenerateContext regenerate session id with context, it is atomic
+// if the storage implements Regenerator.
+func (m *Manager) RegenerateContext(ctx context.Context, write http.ResponseWriter, old *Session) (*Session, error) {
+	ns := m.NewSession()
+	ns.w, ns.req = write, old.req
+
+	ns.Values = deepCopy(old.Values)
+	ns.principal = old.principal
+	ns.binding = old.binding
+
+	if rg, ok := m.store.(Regenerator); ok {
+		if err := rg.Regenerate(ctx, old, ns, m.cfg.RegenerateGrace); err != nil {
+			debug.trace(err)
+			return ns, fmt.Errorf("%w: %v", ErrMigrateSessionFail, err)
+		}
+	} else {
+		if err := m.cs().WriteContext(ctx, ns); err != nil {
+			debug.trace(err)
+			return ns, fmt.Errorf("%w: %v", ErrMigrateSessionFail, err)
+		}
+		if err := m.retire(ctx, old); err != nil {
+			debug.trace(err)
+			return ns, fmt.Errorf("%w: %v", ErrRemoveSessionFail, err)
+		}
+	}
+
+	old.next = ns
+	cookie := m.NewCookie()
+	cookie.Value = m.encodeValue(ns.id)
+	cookie.MaxAge = maxAge(ns)
+	m.setCookie(write, cookie)
+	debug.trace(old, ns)
+	m.emit(ctx, EventMigrate, ns, old.id)
+	return ns, nil
+}
+
+// retire remove old session or shorten it to grace window
+func (m *Manager) retire(ctx context.Context, old *Session) error {
+	grace := m.cfg.RegenerateGrace
+	if grace <= 0 {
+		return m.cs().RemoveContext(ctx, old)
+	}
+	if deadline := time.Now().Add(grace); deadline.Before(old.ExpireTime) {
+		old.ExpireTime = deadline
+		return m.cs().WriteContext(ctx, old)
+	}
+	return nil
+}
+
+// Invalidate remove the session
+func (m *Manager) Invalidate(s *Session) error {
+	return m.InvalidateContext(context.Background(), s)
+}
+
+// InvalidateContext remove the session with context
+func (m *Manager) InvalidateContext(ctx context.Context, s *Session) error {
+	debug.trace(s)
+	s.removed = true
+	if err := m.cs().RemoveContext(ctx, s); err != nil {
+		return err
+	}
+	m.emit(ctx, EventInvalidate, s, "")
+	return nil
+}
+
+// Bind bind the session to principal id and save it to the principal index,
+// the session id should be regenerated before binding after login.
+func (m *Manager) Bind(s *Session, principal string) error {
+	return m.BindContext(context.Background(), s, principal)
+}
+
+// BindContext bind the session to principal id with context
+func (m *Manager) BindContext(ctx context.Context, s *Session, principal string) error {
+	debug.trace(s, principal)
+	bound := s.principal
+	s.principal = principal
+	s.dirty = true
+	if err := m.bind(ctx, s); err != nil {
+		s.principal = bound
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// bind write bound session, enforce MaxSessions if it is configured
+func (m *Manager) bind(ctx context.Context, s *Session) error {
+	if m.cfg.MaxSessions <= 0 || s.principal == "" {
+		return m.cs().WriteContext(ctx, s)
+	}
+	limiter, ok := m.store.(SessionLimiter)
+	if !ok {
+		return ErrLimitUnsupported
+	}
+	evicted, err := limiter.BindLimit(ctx, s, m.cfg.MaxSessions, m.cfg.LimitPolicy)
+	debug.trace(evicted)
+	for _, sid := range evicted {
+		m.emit(ctx, EventEvict, &Session{session{id: sid, m: m, principal: s.principal}}, "")
+	}
+	return err
+}
+
+// principalIndex return storage principal index
+func (m *Manager) principalIndex() (PrincipalIndex, error) {
+	if pi, ok := m.store.(PrincipalIndex); ok {
+		return pi, nil
+	}
+	return nil, ErrIndexUnsupported
+}
+
+// ListUserSessions return live session ids bound to the principal
+func (m *Manager) ListUserSessions(ctx context.Context, principal string) ([]string, error) {
+	pi, err := m.principalIndex()
+	if err != nil {
+		return nil, err
+	}
+	return pi.ListUserSessions(ctx, principal)
+}
+
+// InvalidateUser remove all sessions bound to the principal, log out everywhere
+func (m *Manager) InvalidateUser(ctx context.Context, principal string) error {
+	pi, err := m.principalIndex()
+	if err != nil {
+		return err
+	}
+	debug.trace(principal)
+	var ids []string
+	if m.listening(EventInvalidate) {
+		ids, _ = pi.ListUserSessions(ctx, principal)
+	}
+	if err := pi.InvalidateUser(ctx, principal); err != nil {
+		return err
+	}
+	for _, sid := range ids {
+		m.emit(ctx, EventInvalidate, &Session{session{id: sid, m: m, principal: principal, removed: true}}, "")
+	}
+	return nil
+}
+
+// NewCookie return manager config cookie pointer
+func (m *Manager) NewCookie() *http.Cookie {
+	return &http.Cookie{
+		Domain:   m.cfg.Domain,
+		Path:     m.cfg.Path,
+		Name:     m.cfg.CookieName,
+		Secure:   m.cfg.Secure,
+		HttpOnly: m.cfg.HttpOnly,
+		SameSite: m.cfg.SameSite,
+	}
+}
+
+// setCookie send session token cookie by manager transport
+func (m *Manager) setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	m.cfg.Transport.Inject(w, m.prepare(cookie))
+}
+
+// prepare apply manager cookie attributes which http.Cookie lacks,
+// browser session cookie has no MaxAge unless it is removed.
+func (m *Manager) prepare(cookie *http.Cookie) *http.Cookie {
+	if m.cfg.BrowserSession && cookie.MaxAge > 0 {
+		cookie.MaxAge = 0
+	}
+	if m.cfg.Partitioned {
+		cookie.Unparsed = append(cookie.Unparsed, "Partitioned")
+	}
+	return cookie
+}
+
+// NewSession return new session bound to the manager
+func (m *Manager) NewSession() *Session {
+	s := m.newSession()
+	s.m = m
+	return s
+}
+
+// newSession return new session with manager lifetime
+func (m *Manager) newSession() *Session {
+	nowTime := time.Now()
+	s := &Session{
+		session: session{
+			id:         m.generateID(),
+			Values:     make(Values),
+			CreateTime: nowTime,
+		},
+	}
+	s.ExpireTime = m.expireAt(s, nowTime)
+	return s
+}
+
+// generateID return new session id
+func (m *Manager) generateID() string {
+	if m.cfg == nil {
+		return RandomID{}.Generate()
+	}
+	return m.cfg.IDGenerator.Generate()
+}
+
+// expireAt return session expire time of access at now,
+// idle timeout slides within the absolute lifetime.
+func (m *Manager) expireAt(s *Session, now time.Time) time.Time {
+	if m.cfg == nil {
+		return s.CreateTime.Add(lifeTime)
+	}
+	absolute := s.CreateTime.Add(m.cfg.LifeTime)
+	if m.cfg.IdleTimeout <= 0 {
+		return absolute
+	}
+	if idle := now.Add(m.cfg.IdleTimeout); idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// renew slide idle session expire time, the storage and cookie are
+// only refreshed when it extends at least RenewInterval.
+func (m *Manager) renew(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	if m.cfg.IdleTimeout <= 0 {
+		return nil
+	}
+	next := m.expireAt(s, time.Now())
+	if next.Sub(s.ExpireTime) < m.cfg.RenewInterval {
+		return nil
+	}
+	s.ExpireTime = next
+	if err := m.cs().WriteContext(ctx, s); err != nil {
+		return err
+	}
+	cookie := m.NewCookie()
+	cookie.Value = m.encodeValue(s.id)
+	cookie.MaxAge = maxAge(s)
+	m.setCookie(w, cookie)
+	debug.trace(s)
+	return nil
+}
+
+// maxAge return cookie max age seconds until session expire
+func maxAge(s *Session) int {
+	return int(time.Until(s.ExpireTime).Round(time.Second) / time.Second)
+}
+
+// createSession return new session
+func (m *Manager) createSession(ctx context.Context, w http.ResponseWriter, req *http.Request) (*Session, error) {
+
+	// FIX BUG:
+	// https://deepsource.io/gh/auula/gws/run/5b13c99b-9101-4e4f-8197-acfd730c28a0/go/SCC-SA4009
+	session := m.NewSession()
+	session.w, session.req = w, req
+	session.binding = m.cfg.Binding.fingerprint(req)
+
+	debug.trace(session)
+
+	cookie := m.NewCookie()
+	cookie.Value = m.encodeValue(session.id)
+	cookie.MaxAge = maxAge(session)
+	if err := m.cs().WriteContext(ctx, session); err != nil {
+		return nil, err
+	}
+
+	debug.trace(cookie)
+
+	m.setCookie(w, cookie)
+
+	debug.trace(session)
+	m.emit(ctx, EventCreate, session, "")
+	return session, nil
+}
@@ -0,0 +1,159 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// sessionKey is request context key of session
+type sessionKey struct{}
+
+// MiddlewareOption is session middleware config parameter option.
+type MiddlewareOption struct {
+	// SkipUnmodified skip saving the session if Values is not modified
+	SkipUnmodified bool
+}
+
+// WithSkipUnmodified set middleware skip saving unmodified session
+var WithSkipUnmodified = func(b bool) func(*MiddlewareOption) {
+	return func(o *MiddlewareOption) {
+		o.SkipUnmodified = b
+	}
+}
+
+// Middleware load session by default manager and save it automatically,
+// the default manager is looked up on each request so Open may run later.
+func Middleware(next http.Handler, opts ...func(*MiddlewareOption)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		std.Middleware(next, opts...).ServeHTTP(w, r)
+	})
+}
+
+// Middleware resolves the session once, stores it in the request context
+// and persists it before the response headers are flushed.
+func (m *Manager) Middleware(next http.Handler, opts ...func(*MiddlewareOption)) http.Handler {
+	var opt MiddlewareOption
+	for _, o := range opts {
+		o(&opt)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := m.GetSession(w, r)
+		if err != nil {
+			debug.trace(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		sw := &sessionWriter{ResponseWriter: w, ctx: r.Context(), session: session}
+		if opt.SkipUnmodified {
+			sw.digest = digest(session)
+		}
+
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionKey{}, session)))
+		sw.save()
+	})
+}
+
+// FromContext return session stored in context by middleware
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	if !ok || s == nil {
+		return nil, false
+	}
+	return s.latest(), true
+}
+
+// sessionWriter save session before response headers are flushed
+type sessionWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	session *Session
+	digest  []byte
+	saved   bool
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	sw.save()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.save()
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *sessionWriter) Flush() {
+	sw.save()
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hand over the connection, e.g. for websocket upgrade
+func (sw *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	sw.save()
+	if h, ok := sw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap return the underlying response writer
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// save persist session once
+func (sw *sessionWriter) save() {
+	if sw.saved {
+		return
+	}
+	sw.saved = true
+
+	// follow the migrated session, skip the invalidated session
+	s := sw.session.latest()
+	if s.removed {
+		return
+	}
+	if s == sw.session && !s.dirty && sw.digest != nil && bytes.Equal(sw.digest, digest(s)) {
+		return
+	}
+	if err := s.SyncContext(sw.ctx); err != nil {
+		debug.trace(err)
+	}
+}
+
+// digest return session values snapshot
+func digest(s *Session) []byte {
+	b, err := json.Marshal(s.Values)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countStore count storage write times
+type countStore struct {
+	*RamStore
+	writes int
+}
+
+func (cs *countStore) Write(s *Session) error {
+	cs.writes++
+	return cs.RamStore.Write(s)
+}
+
+// TestMiddleware testing middleware load and auto save session
+func TestMiddleware(t *testing.T) {
+	store := &countStore{RamStore: NewRAM()}
+	opt := NewOptions()
+	m, _ := NewManager(&opt, store)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := FromContext(r.Context())
+		if !ok {
+			t.Fatal("session not found in context")
+		}
+		if r.URL.Path == "/set" {
+			s.Values["foo"] = "bar"
+		}
+		w.WriteHeader(http.StatusOK)
+	}), WithSkipUnmodified(true))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/set", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	// one write when created, one write when modified
+	if store.writes != 2 {
+		t.Errorf("writes = %d, want 2", store.writes)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if store.writes != 2 {
+		t.Errorf("unmodified session saved, writes = %d", store.writes)
+	}
+
+	var session Session
+	session.id = cookies[0].Value
+	if err := store.Read(&session); err != nil || session.Values["foo"] != "bar" {
+		t.Errorf("session not saved: %v %v", err, session.Values)
+	}
+
+	// package level middleware resolves the default manager per request
+	std = new(Manager)
+	handler = Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err := StoreFactory(NewOptions(), NewRAM()); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+		t.Errorf("code = %d, cookies = %v", w.Code, w.Result().Cookies())
+	}
+
+	// hijacker is forwarded for websocket upgrades
+	srv := httptest.NewServer(m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("middleware writer is not http.Hijacker")
+			return
+		}
+		conn, buf, err := h.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		buf.Flush()
+	})))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("code = %d, want 101", resp.StatusCode)
+	}
+	if _, _, err := (&sessionWriter{ResponseWriter: httptest.NewRecorder(), ctx: context.Background(), session: m.NewSession()}).Hijack(); err != http.ErrNotSupported {
+		t.Errorf("Hijack() = %v, want ErrNotSupported", err)
+	}
+}
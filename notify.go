@@ -0,0 +1,192 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// shadowMargin keep session data readable after its shadow key expires,
+// so that the expired event handler can still claim the data.
+const shadowMargin = time.Minute
+
+// ErrEventsDisabled redis server does not emit expired keyevent notifications
+var ErrEventsDisabled = errors.New("redis notify-keyspace-events does not enable expired keyevent")
+
+// notify is redis expired keyevent subscription
+type notify struct {
+	mu        sync.Mutex
+	pubsub    *redis.PubSub
+	expired   []func(s *Session)
+	configure bool
+	onError   func(err error)
+}
+
+// claimScript get and delete expired session data, only one
+// subscribed instance claims the data of an expired session.
+var claimScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if data then
+	redis.call('DEL', KEYS[1])
+end
+return data
+`)
+
+// OnExpire register callback called with session expired by redis,
+// sessions are only reported when ExpiryEvents is enabled.
+func (rds *RdsStore) OnExpire(fn func(s *Session)) {
+	rds.notify.mu.Lock()
+	defer rds.notify.mu.Unlock()
+	rds.notify.expired = append(rds.notify.expired, fn)
+}
+
+// Close stop expired event subscription and close redis client
+func (rds *RdsStore) Close() error {
+	rds.notify.mu.Lock()
+	pubsub := rds.notify.pubsub
+	rds.notify.pubsub = nil
+	rds.notify.mu.Unlock()
+	if pubsub != nil {
+		_ = pubsub.Close()
+	}
+	return rds.store.Close()
+}
+
+// listen subscribe expired keyevent notification
+func (rds *RdsStore) listen() {
+	ctx := context.Background()
+	pubsub := rds.store.Subscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", rds.db))
+	rds.notify.pubsub = pubsub
+	go func() {
+		for msg := range pubsub.Channel() {
+			rds.claim(msg.Payload)
+		}
+	}()
+}
+
+// enableNotify check expired keyevent flags of server config, they are only
+// added when ConfigureEvents is set because the config is server wide.
+func (rds *RdsStore) enableNotify(ctx context.Context) error {
+	vals, err := rds.store.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return fmt.Errorf("get notify-keyspace-events: %w", err)
+	}
+	var flags string
+	if len(vals) == 2 {
+		flags, _ = vals[1].(string)
+	}
+	if strings.Contains(flags, "E") && strings.ContainsAny(flags, "xA") {
+		return nil
+	}
+	if !rds.notify.configure {
+		return ErrEventsDisabled
+	}
+	if err := rds.store.ConfigSet(ctx, "notify-keyspace-events", flags+"Ex").Err(); err != nil {
+		return fmt.Errorf("set notify-keyspace-events: %w", err)
+	}
+	return nil
+}
+
+// checkNotify enable expired keyevent notification and report the failure,
+// managed servers may forbid CONFIG and need it configured manually.
+func (rds *RdsStore) checkNotify() error {
+	if !rds.events {
+		return nil
+	}
+	timeout, cancelFunc := timeoutCtx(context.Background())
+	defer cancelFunc()
+	err := rds.enableNotify(timeout)
+	if err != nil {
+		debug.trace(err)
+		if rds.notify.onError != nil {
+			rds.notify.onError(err)
+		}
+	}
+	return err
+}
+
+// margin return how long session data outlives its shadow key,
+// the expired shadow key triggers the expired event.
+func (rds *RdsStore) margin() time.Duration {
+	if !rds.events {
+		return 0
+	}
+	return shadowMargin
+}
+
+// livePrefix return key prefix whose key exists while the session is live,
+// session data outlives expiry by shadowMargin when expiry events are enabled.
+func (rds *RdsStore) livePrefix() string {
+	if rds.events {
+		return rds.formatShadow("")
+	}
+	return rds.formatPrefix("")
+}
+
+// claim claim data of expired shadow key and report the session
+func (rds *RdsStore) claim(key string) {
+	shadow := rds.formatShadow("")
+	if !strings.HasPrefix(key, shadow) {
+		return
+	}
+	s := &Session{session{id: strings.TrimPrefix(key, shadow)}}
+	timeout, cancelFunc := timeoutCtx(context.Background())
+	defer cancelFunc()
+
+	// data is missing when the session is removed or claimed by another instance
+	val, err := claimScript.Run(timeout, rds.store, []string{rds.formatPrefix(s.id)}).Text()
+	if err != nil {
+		debug.trace(err)
+		return
+	}
+	var r record
+	if err := rds.codec.Decode([]byte(val), &r); err != nil {
+		debug.trace(err)
+		return
+	}
+	s.restore(&r)
+	if s.principal != "" {
+		_ = rds.store.ZRem(timeout, rds.formatIndex(s.principal), s.id).Err()
+		_ = rds.store.ZRem(timeout, rds.formatSeen(s.principal), s.id).Err()
+	}
+	debug.trace(s)
+
+	rds.notify.mu.Lock()
+	callbacks := rds.notify.expired
+	rds.notify.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(s)
+	}
+}
+
+// formatShadow format redis shadow key of session
+func (rds *RdsStore) formatShadow(sid string) string {
+	return fmt.Sprintf("%s:shadow:%s", rds.prefix, sid)
+}
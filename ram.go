@@ -0,0 +1,485 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultShards is RamStore shard count when it is not configured
+const defaultShards = 32
+
+// RamStore Local memory storage.
+// Sessions are sharded by id hash with a lock per shard, each shard
+// expires its sessions by one scheduler goroutine, stop them by Close.
+type RamStore struct {
+	shards      []*shard
+	mask        uint32
+	index       sync.RWMutex // guards principals, locked after shards
+	principals  map[string]map[string]struct{}
+	capacity    Capacity
+	entries     int64  // atomic
+	bytes       int64  // atomic
+	evictions   uint64 // atomic
+	expirations uint64 // atomic
+	cursor      uint32 // atomic, shard to sample eviction victim
+	hooks       sync.RWMutex
+	onExpire    []func(s *Session)
+	onEvict     []func(s *Session)
+	nshards     int
+	snapshot    Snapshot
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// shard is part of ram store sessions with its lock and expiry scheduler
+type shard struct {
+	rw       sync.RWMutex
+	store    map[string]*entry
+	schedule *schedule
+}
+
+// entry is stored session with its usage
+type entry struct {
+	s    *Session
+	size int64 // approximate memory bytes
+	seen int64 // last access unix nano, atomic
+	hits int64 // access count, atomic
+}
+
+var (
+	// WithRAMShards set ram store shard count, it is rounded up to power of two,
+	// zero is default 32 shards
+	WithRAMShards = func(n int) func(*RamStore) {
+		return func(ram *RamStore) {
+			ram.nshards = n
+		}
+	}
+
+	// WithRAMCapacity set ram store capacity
+	WithRAMCapacity = func(c Capacity) func(*RamStore) {
+		return func(ram *RamStore) {
+			ram.capacity = c
+		}
+	}
+
+	// WithRAMSnapshot set ram store snapshot file
+	WithRAMSnapshot = func(s Snapshot) func(*RamStore) {
+		return func(ram *RamStore) {
+			ram.snapshot = s
+		}
+	}
+)
+
+// NewRAM return local memory storage, unexpired sessions
+// are loaded from the snapshot file if it is configured.
+func NewRAM(opts ...func(*RamStore)) *RamStore {
+	ram := &RamStore{
+		principals: make(map[string]map[string]struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ram)
+	}
+	n := 1
+	for n < ram.nshards || (ram.nshards <= 0 && n < defaultShards) {
+		n <<= 1
+	}
+	ram.shards = make([]*shard, n)
+	ram.mask = uint32(n - 1)
+	for i := range ram.shards {
+		ram.shards[i] = &shard{
+			store:    make(map[string]*entry),
+			schedule: newSchedule(),
+		}
+	}
+	if ram.snapshot.Path != "" {
+		ram.restore()
+		ram.shrink("")
+		go ram.persist()
+	}
+	for _, sh := range ram.shards {
+		go ram.gc(sh)
+	}
+	return ram
+}
+
+// shardOf return shard of session id by FNV-1a hash
+func (ram *RamStore) shardOf(sid string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(sid); i++ {
+		hash ^= uint32(sid[i])
+		hash *= 16777619
+	}
+	return ram.shards[hash&ram.mask]
+}
+
+// lockAll lock every shard in order, used by cross shard operations
+func (ram *RamStore) lockAll() {
+	for _, sh := range ram.shards {
+		sh.rw.Lock()
+	}
+}
+
+// unlockAll unlock every shard
+func (ram *RamStore) unlockAll() {
+	for _, sh := range ram.shards {
+		sh.rw.Unlock()
+	}
+}
+
+func (ram *RamStore) Read(s *Session) (err error) {
+	sh := ram.shardOf(s.id)
+	sh.rw.RLock()
+	defer func() {
+		sh.rw.RUnlock()
+	}()
+	if e, ok := sh.store[s.id]; ok && time.Now().Before(e.s.ExpireTime) {
+		s.Values = e.s.Values.clone()
+		s.CreateTime = e.s.CreateTime
+		s.ExpireTime = e.s.ExpireTime
+		s.principal = e.s.principal
+		s.binding = e.s.binding
+		e.touch()
+		return nil
+	}
+	debug.trace(s)
+	return ErrSessionNoData
+}
+
+func (ram *RamStore) Write(s *Session) (err error) {
+	sh := ram.shardOf(s.id)
+	sh.rw.Lock()
+	ram.put(sh, s)
+	sh.rw.Unlock()
+	ram.shrink(s.id)
+	debug.trace(s)
+	return nil
+}
+
+func (ram *RamStore) Remove(s *Session) (err error) {
+	sh := ram.shardOf(s.id)
+	sh.rw.Lock()
+	defer sh.rw.Unlock()
+	ram.drop(sh, s.id)
+	debug.trace(s)
+	return nil
+}
+
+// Regenerate swap old session to new session under both shard locks
+func (ram *RamStore) Regenerate(ctx context.Context, old, ns *Session, grace time.Duration) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	os, nsh := ram.shardOf(old.id), ram.shardOf(ns.id)
+	unlock := ram.lockPair(os, nsh)
+	ram.put(nsh, ns)
+	if stored, ok := os.store[old.id]; ok {
+		if grace <= 0 {
+			ram.drop(os, old.id)
+		} else if deadline := time.Now().Add(grace); deadline.Before(stored.s.ExpireTime) {
+			// shorten lifetime of stored copy to grace window, the caller's old session is untouched
+			cp := *stored.s
+			cp.ExpireTime = deadline
+			stored.s = &cp
+			os.schedule.set(old.id, deadline)
+		}
+	}
+	unlock()
+	ram.shrink(ns.id)
+	debug.trace(old, ns)
+	return nil
+}
+
+// lockPair lock two shards in shard order and return the unlock function
+func (ram *RamStore) lockPair(a, b *shard) func() {
+	if a == b {
+		a.rw.Lock()
+		return a.rw.Unlock
+	}
+	for _, sh := range ram.shards {
+		if sh == a || sh == b {
+			sh.rw.Lock()
+		}
+	}
+	return func() {
+		a.rw.Unlock()
+		b.rw.Unlock()
+	}
+}
+
+// ListUserSessions return session ids bound to the principal
+func (ram *RamStore) ListUserSessions(ctx context.Context, principal string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ram.userSessions(principal), nil
+}
+
+// userSessions return copy of principal index
+func (ram *RamStore) userSessions(principal string) []string {
+	ram.index.RLock()
+	defer ram.index.RUnlock()
+	ids := make([]string, 0, len(ram.principals[principal]))
+	for sid := range ram.principals[principal] {
+		ids = append(ids, sid)
+	}
+	return ids
+}
+
+// InvalidateUser remove all sessions bound to the principal
+func (ram *RamStore) InvalidateUser(ctx context.Context, principal string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ram.lockAll()
+	defer ram.unlockAll()
+	for _, sid := range ram.userSessions(principal) {
+		ram.drop(ram.shardOf(sid), sid)
+	}
+	return nil
+}
+
+// OnExpire register callback called with session removed by gc
+func (ram *RamStore) OnExpire(fn func(s *Session)) {
+	ram.hooks.Lock()
+	defer ram.hooks.Unlock()
+	ram.onExpire = append(ram.onExpire, fn)
+}
+
+// OnEvict register callback called with session evicted by capacity
+func (ram *RamStore) OnEvict(fn func(s *Session)) {
+	ram.hooks.Lock()
+	defer ram.hooks.Unlock()
+	ram.onEvict = append(ram.onEvict, fn)
+}
+
+// notify call registered callbacks with session
+func (ram *RamStore) notify(callbacks *[]func(s *Session), s *Session) {
+	ram.hooks.RLock()
+	fns := *callbacks
+	ram.hooks.RUnlock()
+	for _, fn := range fns {
+		fn(s)
+	}
+}
+
+// Stats return ram store current usage
+func (ram *RamStore) Stats() Stats {
+	return Stats{
+		Sessions:    int(atomic.LoadInt64(&ram.entries)),
+		Bytes:       atomic.LoadInt64(&ram.bytes),
+		Evictions:   atomic.LoadUint64(&ram.evictions),
+		Expirations: atomic.LoadUint64(&ram.expirations),
+	}
+}
+
+// put store session, reschedule it and update principal index,
+// shard lock must be held
+func (ram *RamStore) put(sh *shard, s *Session) {
+	var size int64
+	if ram.capacity.MaxBytes > 0 {
+		// sizing walks Values, it is only paid when bytes are bounded
+		size = approxSize(s)
+	}
+	e, ok := sh.store[s.id]
+	if ok {
+		ram.reindex(s.id, e.s.principal, s.principal)
+		atomic.AddInt64(&ram.bytes, size-e.size)
+	} else {
+		e = new(entry)
+		sh.store[s.id] = e
+		ram.reindex(s.id, "", s.principal)
+		atomic.AddInt64(&ram.entries, 1)
+		atomic.AddInt64(&ram.bytes, size)
+	}
+	e.s = detach(s)
+	e.size = size
+	e.touch()
+
+	// reschedule when session is renewed
+	sh.schedule.set(s.id, s.ExpireTime)
+}
+
+// detach return stored copy of session without manager, migration and request references,
+// so that the store does not keep the request alive for the session lifetime,
+// and concurrent requests of the same session do not share Values map
+func detach(s *Session) *Session {
+	return &Session{session{
+		id:         s.id,
+		principal:  s.principal,
+		binding:    s.binding,
+		CreateTime: s.CreateTime,
+		ExpireTime: s.ExpireTime,
+		Values:     s.Values.clone(),
+	}}
+}
+
+// drop delete session, its schedule and principal index, shard lock must be held
+func (ram *RamStore) drop(sh *shard, sid string) {
+	e, ok := sh.store[sid]
+	if !ok {
+		return
+	}
+	sh.schedule.remove(sid)
+	ram.reindex(sid, e.s.principal, "")
+	atomic.AddInt64(&ram.entries, -1)
+	atomic.AddInt64(&ram.bytes, -e.size)
+	delete(sh.store, sid)
+}
+
+// reindex move session id from old principal index to new one
+func (ram *RamStore) reindex(sid, old, principal string) {
+	if old == principal {
+		return
+	}
+	ram.index.Lock()
+	defer ram.index.Unlock()
+	if ids, ok := ram.principals[old]; ok {
+		delete(ids, sid)
+		if len(ids) == 0 {
+			delete(ram.principals, old)
+		}
+	}
+	if principal != "" {
+		if ram.principals[principal] == nil {
+			ram.principals[principal] = make(map[string]struct{})
+		}
+		ram.principals[principal][sid] = struct{}{}
+	}
+}
+
+// over check whether ram store is over capacity
+func (ram *RamStore) over() bool {
+	c := ram.capacity
+	return (c.MaxEntries > 0 && atomic.LoadInt64(&ram.entries) > int64(c.MaxEntries)) ||
+		(c.MaxBytes > 0 && atomic.LoadInt64(&ram.bytes) > c.MaxBytes)
+}
+
+// shrink evict sampled sessions until ram store is within capacity,
+// the keep session is never evicted. No shard lock may be held.
+func (ram *RamStore) shrink(keep string) {
+	for ram.over() {
+		sh, sid := ram.victim(keep)
+		if sh == nil {
+			return
+		}
+		sh.rw.Lock()
+		e, ok := sh.store[sid]
+		if ok {
+			ram.drop(sh, sid)
+			atomic.AddUint64(&ram.evictions, 1)
+		}
+		sh.rw.Unlock()
+		if ok {
+			debug.trace(e.s)
+			ram.notify(&ram.onEvict, e.s)
+		}
+	}
+}
+
+// victim return the lowest score session of sampled sessions,
+// sampling starts from a rotating shard.
+func (ram *RamStore) victim(keep string) (*shard, string) {
+	var (
+		best   *shard
+		victim string
+		lowest int64
+		n      int
+	)
+	start := atomic.AddUint32(&ram.cursor, 1)
+	for i := uint32(0); i <= ram.mask && n < evictionSamples; i++ {
+		sh := ram.shards[(start+i)&ram.mask]
+		sh.rw.RLock()
+		for sid, e := range sh.store {
+			if sid == keep {
+				continue
+			}
+			if score := e.score(ram.capacity.Eviction); victim == "" || score < lowest {
+				best, victim, lowest = sh, sid, score
+			}
+			if n++; n >= evictionSamples {
+				break
+			}
+		}
+		sh.rw.RUnlock()
+	}
+	return best, victim
+}
+
+// gc is shard garbage collection, it sleeps until the earliest
+// expire time and removes expired sessions in batches.
+func (ram *RamStore) gc(sh *shard) {
+	timer := time.NewTimer(idleWait)
+	defer timer.Stop()
+	for {
+		sh.rw.Lock()
+		var expired []*Session
+		for _, sid := range sh.schedule.due(time.Now(), sweepBatch) {
+			if e, ok := sh.store[sid]; ok {
+				expired = append(expired, e.s)
+				ram.drop(sh, sid)
+			}
+		}
+		wait := sh.schedule.wait(time.Now())
+		sh.rw.Unlock()
+
+		atomic.AddUint64(&ram.expirations, uint64(len(expired)))
+		for _, s := range expired {
+			debug.trace(s)
+			ram.notify(&ram.onExpire, s)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-sh.schedule.done:
+			return
+		case <-sh.schedule.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Close stop ram store garbage collection, sessions no longer expire.
+// The snapshot is written once more if it is configured.
+func (ram *RamStore) Close() (err error) {
+	ram.closeOnce.Do(func() {
+		close(ram.done)
+		for _, sh := range ram.shards {
+			sh.schedule.stop()
+		}
+		if ram.snapshot.Path != "" {
+			err = ram.Save()
+		}
+	})
+	return err
+}
@@ -0,0 +1,142 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+const (
+	sweepBatch = 1024      // Max expired sessions removed under one lock
+	idleWait   = time.Hour // Scheduler wait when no session is scheduled
+)
+
+// deadline is scheduled session expire time
+type deadline struct {
+	sid   string
+	at    time.Time
+	index int
+}
+
+// deadlines is min-heap of deadline by expire time
+type deadlines []*deadline
+
+func (d deadlines) Len() int           { return len(d) }
+func (d deadlines) Less(i, j int) bool { return d[i].at.Before(d[j].at) }
+
+func (d deadlines) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+	d[i].index = i
+	d[j].index = j
+}
+
+func (d *deadlines) Push(x interface{}) {
+	item := x.(*deadline)
+	item.index = len(*d)
+	*d = append(*d, item)
+}
+
+func (d *deadlines) Pop() interface{} {
+	old := *d
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*d = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// schedule is session expiry scheduler, renewal and removal are
+// O(log n) heap operations, the store lock must be held to use it.
+type schedule struct {
+	heap     deadlines
+	bySid    map[string]*deadline
+	wake     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newSchedule() *schedule {
+	return &schedule{
+		bySid: make(map[string]*deadline),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// set schedule or reschedule session expire time,
+// the scheduler is woken up when it becomes the earliest.
+func (sc *schedule) set(sid string, at time.Time) {
+	if item, ok := sc.bySid[sid]; ok {
+		item.at = at
+		heap.Fix(&sc.heap, item.index)
+	} else {
+		item = &deadline{sid: sid, at: at}
+		sc.bySid[sid] = item
+		heap.Push(&sc.heap, item)
+	}
+	if sc.heap[0].sid == sid {
+		select {
+		case sc.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove unschedule session
+func (sc *schedule) remove(sid string) {
+	if item, ok := sc.bySid[sid]; ok {
+		heap.Remove(&sc.heap, item.index)
+		delete(sc.bySid, sid)
+	}
+}
+
+// due unschedule and return at most limit session ids expired at now
+func (sc *schedule) due(now time.Time, limit int) []string {
+	var ids []string
+	for len(sc.heap) > 0 && len(ids) < limit && !sc.heap[0].at.After(now) {
+		item := heap.Pop(&sc.heap).(*deadline)
+		delete(sc.bySid, item.sid)
+		ids = append(ids, item.sid)
+	}
+	return ids
+}
+
+// wait return duration until the earliest expire time
+func (sc *schedule) wait(now time.Time) time.Duration {
+	if len(sc.heap) == 0 {
+		return idleWait
+	}
+	if d := sc.heap[0].at.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// stop stop the scheduler goroutine
+func (sc *schedule) stop() {
+	sc.stopOnce.Do(func() {
+		close(sc.done)
+	})
+}
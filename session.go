@@ -23,28 +23,24 @@
 package gws
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
-	"sync"
+	"reflect"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	// Global session storage controller
-	globalStore Storage
-
-	// Global Configure controller
-	globalConfig *Config
-
-	// Session concurrent safe mutex
-	migrateMux sync.Mutex
+	// Default session manager used by package level functions
+	std = new(Manager)
 
 	ErrSessionNoData      = errors.New("session no data")
 	ErrRemoveSessionFail  = errors.New("remove session fail")
 	ErrMigrateSessionFail = errors.New("migrate session fail")
+	ErrIndexUnsupported   = errors.New("storage does not support principal index")
 )
 
 // Values is session item value
@@ -58,6 +54,14 @@ type Session struct {
 // session struct
 type session struct {
 	id         string
+	m          *Manager
+	next       *Session            // migrated new session
+	removed    bool                // session has been invalidated
+	dirty      bool                // session has been modified by api
+	principal  string              // principal id bound to the session
+	binding    map[string]string   // client attribute hashes bound to the session
+	w          http.ResponseWriter // request exchange used by cookie storage
+	req        *http.Request
 	CreateTime time.Time
 	ExpireTime time.Time
 	Values
@@ -65,23 +69,12 @@ type session struct {
 
 // GetSession Get session data from the Request
 func GetSession(w http.ResponseWriter, req *http.Request) (*Session, error) {
-	var session Session
-
-	cookie, err := req.Cookie(globalConfig.CookieName)
-	if cookie == nil || err != nil {
-		debug.trace(cookie)
-		return createSession(w, cookie)
-	}
-
-	if len(cookie.Value) >= 73 {
-		session.id = cookie.Value
-		if globalStore.Read(&session) != nil {
-			return createSession(w, cookie)
-		}
-	}
+	return std.GetSession(w, req)
+}
 
-	debug.trace(&session)
-	return &session, nil
+// GetSessionContext Get session data from the Request with context
+func GetSessionContext(ctx context.Context, w http.ResponseWriter, req *http.Request) (*Session, error) {
+	return std.GetSessionContext(ctx, w, req)
 }
 
 // ID return session id
@@ -89,73 +82,88 @@ func (s *Session) ID() string {
 	return s.id
 }
 
-// Sync save data modify
+// Principal return principal id bound to the session
+func (s *Session) Principal() string {
+	return s.principal
+}
+
+// Sync save data modify, every storage keeps its own copy of Values,
+// so modifications are lost without Sync or Middleware.
 func (s *Session) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext save data modify with context
+func (s *Session) SyncContext(ctx context.Context) error {
 	debug.trace(s)
-	return globalStore.Write(s)
+	m := s.manager()
+	if err := m.cs().WriteContext(ctx, s); err != nil {
+		return err
+	}
+	s.dirty = false
+	m.emit(ctx, EventSave, s, "")
+	return nil
 }
 
-// Migrate migrate old session data to new session
-func Migrate(write http.ResponseWriter, old *Session) (*Session, error) {
-	var (
-		ns     = NewSession()
-		cookie = NewCookie()
-	)
-
-	migrateMux.Lock()
-	ns.Values = old.Values
-	cookie.Value = ns.id
-	cookie.MaxAge = int(globalConfig.LifeTime) / 1e9
-	migrateMux.Unlock()
-
-	return ns,
-		func() error {
-			if ns.Sync() != nil {
-				return ErrMigrateSessionFail
-			}
-			if globalStore.Remove(old) != nil {
-				return ErrRemoveSessionFail
-			}
-			http.SetCookie(write, cookie)
-			return nil
-		}()
-}
-
-// createSession return new session
-func createSession(w http.ResponseWriter, cookie *http.Cookie) (*Session, error) {
-
-	// FIX BUG:
-	// https://deepsource.io/gh/auula/gws/run/5b13c99b-9101-4e4f-8197-acfd730c28a0/go/SCC-SA4009
-	session := NewSession()
-
-	debug.trace(session)
-
-	if cookie == nil {
-		cookie = NewCookie()
+// latest return the newest session after migrate
+func (s *Session) latest() *Session {
+	for s.next != nil {
+		s = s.next
 	}
-	cookie.Value = session.id
-	cookie.MaxAge = int(globalConfig.LifeTime) / 1e9
-	if err := globalStore.Write(session); err != nil {
-		return nil, err
+	return s
+}
+
+// manager return the session manager, default manager if not bound
+func (s *Session) manager() *Manager {
+	if s.m != nil {
+		return s.m
 	}
+	return std
+}
 
-	debug.trace(cookie)
+// Migrate migrate old session data to new session
+func Migrate(write http.ResponseWriter, old *Session) (*Session, error) {
+	return std.Migrate(write, old)
+}
 
-	http.SetCookie(w, cookie)
+// MigrateContext migrate old session data to new session with context
+func MigrateContext(ctx context.Context, write http.ResponseWriter, old *Session) (*Session, error) {
+	return std.MigrateContext(ctx, write, old)
+}
+
+// Regenerate regenerate session id with deep copied values
+func Regenerate(write http.ResponseWriter, old *Session) (*Session, error) {
+	return std.Regenerate(write, old)
+}
 
-	debug.trace(session)
-	return session, nil
+// RegenerateContext regenerate session id with context
+func RegenerateContext(ctx context.Context, write http.ResponseWriter, old *Session) (*Session, error) {
+	return std.RegenerateContext(ctx, write, old)
+}
+
+// Bind bind the session to principal id
+func Bind(s *Session, principal string) error {
+	return std.Bind(s, principal)
+}
+
+// BindContext bind the session to principal id with context
+func BindContext(ctx context.Context, s *Session, principal string) error {
+	return std.BindContext(ctx, s, principal)
+}
+
+// ListUserSessions return live session ids bound to the principal
+func ListUserSessions(ctx context.Context, principal string) ([]string, error) {
+	return std.ListUserSessions(ctx, principal)
+}
+
+// InvalidateUser remove all sessions bound to the principal
+func InvalidateUser(ctx context.Context, principal string) error {
+	return std.InvalidateUser(ctx, principal)
 }
 
 // NewCookie return default config cookie pointer
 func NewCookie() *http.Cookie {
-	return &http.Cookie{
-		Domain:   globalConfig.Domain,
-		Path:     globalConfig.Path,
-		Name:     globalConfig.CookieName,
-		Secure:   globalConfig.Secure,
-		HttpOnly: globalConfig.HttpOnly,
-	}
+	return std.NewCookie()
 }
 
 // uuid73 generate session uuid length 73
@@ -163,28 +171,29 @@ func uuid73() string {
 	return fmt.Sprintf("%s-%s", uuid.New().String(), uuid.New().String())
 }
 
-// NewSession return new session
+// NewSession return new session with default manager lifetime
 func NewSession() *Session {
-	nowTime := time.Now()
-	return &Session{
-		session: session{
-			id:         uuid73(),
-			Values:     make(Values),
-			CreateTime: nowTime,
-			ExpireTime: nowTime.Add(lifeTime),
-		},
-	}
+	return std.newSession()
 }
 
-// Expired check current session whether expire
+// Expired check current session whether expire,
+// by idle expire time or absolute lifetime.
 func (s *Session) Expired() bool {
-	return time.Duration(s.ExpireTime.UnixNano()) <= time.Duration(time.Now().UnixNano())
+	now := time.Now()
+	if m := s.manager(); m.cfg != nil && !now.Before(s.CreateTime.Add(m.cfg.LifeTime)) {
+		return true
+	}
+	return !now.Before(s.ExpireTime)
 }
 
 // Invalidate remove the session
 func Invalidate(s *Session) error {
-	debug.trace(s)
-	return globalStore.Remove(s)
+	return std.Invalidate(s)
+}
+
+// InvalidateContext remove the session with context
+func InvalidateContext(ctx context.Context, s *Session) error {
+	return std.InvalidateContext(ctx, s)
 }
 
 // Malloc reallocation of memory
@@ -192,28 +201,47 @@ func Malloc(v *Values) {
 	*v = make(Values)
 }
 
-// Open Initialize storage with custom configuration
-func Open(opt Configure) {
-	debug.trace(opt)
-	globalConfig = opt.Parse()
-	switch globalConfig.store {
-	case ram:
-		globalStore = NewRAM()
-	case rds:
-		rdb := NewRds()
-		timeout, cancelFunc := timeoutCtx()
-		defer cancelFunc()
-		if err := rdb.store.Ping(timeout).Err(); err != nil {
-			panic(err.Error())
-		}
-		globalStore = rdb
-	default:
-		globalStore = NewRAM()
+// Open Initialize storage with custom configuration, hooks registered by On
+// are kept and the storage of the replaced default manager is closed.
+func Open(opt Configure) error {
+	m, err := NewManager(opt, nil)
+	if err != nil {
+		return err
 	}
+	replace(m)
+	return nil
 }
 
-// StoreFactory Initialize custom storage media
-func StoreFactory(opt Options, store Storage) {
-	globalConfig = opt.Parse()
-	globalStore = store
+// Close close the default manager storage
+func Close() error {
+	return std.Close()
+}
+
+// StoreFactory Initialize custom storage media, hooks registered by On
+// are kept and the storage of the replaced default manager is closed.
+func StoreFactory(opt Options, store Storage) error {
+	m, err := NewManager(&opt, store)
+	if err != nil {
+		return err
+	}
+	replace(m)
+	return nil
+}
+
+// replace swap the default manager, keep its hooks and close storage
+// of the old one, so that its gc goroutines and connections are not leaked
+func replace(m *Manager) {
+	old := std
+	m.adopt(old)
+	std = m
+	if old.store == nil {
+		return
+	}
+	// a custom storage may be reused by the new manager
+	if reflect.TypeOf(old.store).Comparable() && old.store == m.store {
+		return
+	}
+	if err := old.Close(); err != nil {
+		debug.trace(err)
+	}
 }
@@ -23,8 +23,11 @@
 package gws
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -137,11 +140,29 @@ func TestStoreFactory(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if &tt.args.store == &globalStore {
+			if &tt.args.store == &std.store {
 				t.Error("store init fail")
 			}
 		})
 	}
+
+	// reused storage stays open, replaced storage is closed
+	closed := func(ram *RamStore) bool {
+		select {
+		case <-ram.done:
+			return true
+		default:
+			return false
+		}
+	}
+	_ = StoreFactory(NewOptions(), store)
+	if closed(store) {
+		t.Error("reused storage closed")
+	}
+	_ = StoreFactory(NewOptions(), NewRAM())
+	if !closed(store) {
+		t.Error("replaced storage not closed")
+	}
 }
 
 // TestRAMStore testing memory storage read write remove
@@ -153,7 +174,7 @@ func TestRAMStore(t *testing.T) {
 	Open(DefaultRAMOptions)
 
 	t.Log("store write session data")
-	if globalStore.Write(&Session{
+	if std.store.Write(&Session{
 		session{
 			id:         uuid,
 			Values:     make(Values),
@@ -169,7 +190,7 @@ func TestRAMStore(t *testing.T) {
 
 	t.Log("store read session data")
 
-	if err := globalStore.Read(&session); err != nil {
+	if err := std.store.Read(&session); err != nil {
 		t.Error(err)
 	}
 
@@ -180,11 +201,11 @@ func TestRAMStore(t *testing.T) {
 	}
 
 	t.Log("store remove session data")
-	if globalStore.Remove(&session) != nil {
+	if std.store.Remove(&session) != nil {
 		t.Error("data synchronization failed")
 	}
 
-	if err := globalStore.Read(&session); err != ErrSessionNoData {
+	if err := std.store.Read(&session); err != ErrSessionNoData {
 		t.Error(err)
 	}
 }
@@ -223,7 +244,9 @@ func TestSessionConcurrent(t *testing.T) {
 }
 
 func TestSessionInvalidate(t *testing.T) {
-	globalStore = NewRAM()
+	if err := StoreFactory(NewOptions(), NewRAM()); err != nil {
+		t.Fatal(err)
+	}
 
 	nowTime := time.Now()
 	uuid := uuid73()
@@ -237,12 +260,363 @@ func TestSessionInvalidate(t *testing.T) {
 		},
 	}
 	// write session to storage
-	globalStore.Write(session)
+	std.store.Write(session)
 
-	t.Log(globalStore.(*RamStore).store)
+	t.Log(std.store.(*RamStore).Stats())
 
 	// invalidate remove session to storage
-	Invalidate(session)
+	if err := Invalidate(session); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(std.store.(*RamStore).Stats())
+	var removed Session
+	removed.id = uuid
+	if err := std.store.Read(&removed); err != ErrSessionNoData {
+		t.Errorf("session not invalidated: %v", err)
+	}
+}
+
+// TestManagerIsolation testing multiple managers in one process
+func TestManagerIsolation(t *testing.T) {
+	uopt := NewOptions(WithCookieName("user_id"))
+	aopt := NewOptions(WithCookieName("admin_id"))
+	user, _ := NewManager(&uopt, NewRAM())
+	admin, _ := NewManager(&aopt, NewRAM())
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	us, err := user.GetSession(w, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.Values["role"] = "user"
+	if err := us.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "user_id" {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+
+	var session Session
+	session.id = us.ID()
+	if admin.Storage().Read(&session) != ErrSessionNoData {
+		t.Error("admin storage should not see user session")
+	}
+	if err := user.Storage().Read(&session); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSessionContext testing caller context reach the storage
+func TestSessionContext(t *testing.T) {
+	opt := NewOptions()
+	m, _ := NewManager(&opt, NewRAM())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	if _, err := m.GetSession(httptest.NewRecorder(), req); err != context.Canceled {
+		t.Errorf("GetSession() error = %v, want %v", err, context.Canceled)
+	}
+
+	s := m.NewSession()
+	if err := s.SyncContext(ctx); err != context.Canceled {
+		t.Errorf("SyncContext() error = %v, want %v", err, context.Canceled)
+	}
+	if err := s.SyncContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestParseValidation testing config validation error list every invalid field
+func TestParseValidation(t *testing.T) {
+	opt := NewRDSOptions("localhost", 6379, "", WithOpts(NewOptions(WithCookieName(""))))
+	_, err := opt.Parse()
+	ve, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Parse() error = %v, want ValidationError", err)
+	}
+	fields := make(map[string]bool)
+	for _, fe := range ve {
+		fields[fe.Field] = true
+	}
+	for _, field := range []string{"CookieName", "Password", "Address"} {
+		if !fields[field] {
+			t.Errorf("field %s not reported in %v", field, ve)
+		}
+	}
+
+	if err := Open(opt); err == nil {
+		t.Error("Open() should return validation error")
+	}
+}
+
+// TestLazyConnect testing redis store start unhealthy when server unreachable
+func TestLazyConnect(t *testing.T) {
+	if _, err := NewManager(NewRDSOptions("127.0.0.1", 1, "passwd"), nil); err == nil {
+		t.Error("NewManager() should fail when redis unreachable")
+	}
+
+	m, err := NewManager(NewRDSOptions("127.0.0.1", 1, "passwd", WithLazyConnect(true)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Storage().(*RdsStore).Healthy() {
+		t.Error("store should start unhealthy")
+	}
+}
+
+// TestSlidingExpiration testing idle timeout renewal within absolute lifetime
+func TestSlidingExpiration(t *testing.T) {
+	opt := NewOptions(WithLifeTime(time.Hour), WithIdleTimeout(10*time.Minute), WithRenewInterval(time.Minute))
+	m, err := NewManager(&opt, NewRAM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := m.NewSession()
+	if d := time.Until(s.ExpireTime); d > 10*time.Minute || d < 9*time.Minute {
+		t.Fatalf("new session expire in %v, want idle timeout", d)
+	}
+
+	get := func() (*Session, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: opt.CookieName, Value: s.ID()})
+		session, err := m.GetSession(w, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session, w
+	}
+
+	// access within throttle does not renew
+	_ = m.Storage().Write(s)
+	if _, w := get(); len(w.Result().Cookies()) != 0 {
+		t.Error("session renewed within renew interval")
+	}
 
-	t.Log(globalStore.(*RamStore).store)
+	// access after idle for 5 minutes renews
+	s.ExpireTime = time.Now().Add(5 * time.Minute)
+	_ = m.Storage().Write(s)
+	session, w := get()
+	if session.ID() != s.ID() || time.Until(session.ExpireTime) < 9*time.Minute {
+		t.Errorf("session not renewed, expire in %v", time.Until(session.ExpireTime))
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge < 590 {
+		t.Errorf("cookie not refreshed %v", cookies)
+	}
+
+	// renewal is capped by absolute lifetime
+	s.CreateTime = time.Now().Add(-55 * time.Minute)
+	s.ExpireTime = time.Now().Add(time.Minute)
+	_ = m.Storage().Write(s)
+	if session, _ = get(); time.Until(session.ExpireTime) > 5*time.Minute {
+		t.Errorf("renewal exceeds absolute lifetime, expire in %v", time.Until(session.ExpireTime))
+	}
+
+	// absolute lifetime exceeded issues a new session
+	s.CreateTime = time.Now().Add(-2 * time.Hour)
+	_ = m.Storage().Write(s)
+	if session, _ = get(); session.ID() == s.ID() {
+		t.Error("expired session returned")
+	}
+}
+
+// readStore count storage read times
+type readStore struct {
+	*RamStore
+	reads int
+}
+
+func (rs *readStore) Read(s *Session) error {
+	rs.reads++
+	return rs.RamStore.Read(s)
+}
+
+// TestIDValidation testing malformed id rejected before storage read
+func TestIDValidation(t *testing.T) {
+	store := &readStore{RamStore: NewRAM()}
+	opt := NewOptions()
+	m, _ := NewManager(&opt, store)
+
+	g := RandomID{}
+	if id := g.Generate(); !g.Validate(id) || len(id) != 43 {
+		t.Errorf("invalid generated id %q", id)
+	}
+	if !(LegacyUUID{}).Validate(uuid73()) {
+		t.Error("legacy id should be valid")
+	}
+
+	for _, value := range []string{"short", strings.Repeat("x", 100), uuid73()} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: opt.CookieName, Value: value})
+		s, err := m.GetSession(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.ID() == "" || s.ID() == value {
+			t.Errorf("malformed id %q not replaced, got %q", value, s.ID())
+		}
+	}
+	if store.reads != 0 {
+		t.Errorf("storage read %d times for malformed id", store.reads)
+	}
+}
+
+// TestSignedCookie testing signed cookie verification and key rotation
+func TestSignedCookie(t *testing.T) {
+	oldKey := []byte(strings.Repeat("o", 32))
+	newKey := []byte(strings.Repeat("n", 32))
+
+	store := &readStore{RamStore: NewRAM()}
+	opt := NewOptions(WithSigningKeys(oldKey))
+	m, err := NewManager(&opt, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s, _ := m.GetSession(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	value := w.Result().Cookies()[0].Value
+	if !strings.HasPrefix(value, s.ID()+".") {
+		t.Fatalf("cookie value %q not signed", value)
+	}
+
+	// rotate keys, old signature still verifies
+	rotated := NewOptions(WithSigningKeys(newKey, oldKey))
+	m.cfg.SigningKeys = rotated.SigningKeys
+
+	get := func(value string) *Session {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: opt.CookieName, Value: value})
+		session, err := m.GetSession(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+
+	if got := get(value); got.ID() != s.ID() {
+		t.Error("session lost after key rotation")
+	}
+	reads := store.reads
+
+	// tampered values rejected without storage read
+	altered := "a" + value[1:]
+	if altered == value {
+		altered = "b" + value[1:]
+	}
+	for _, tampered := range []string{s.ID(), value + "x", altered} {
+		if got := get(tampered); got.ID() == s.ID() {
+			t.Errorf("tampered value %q accepted", tampered)
+		}
+	}
+	if store.reads != reads {
+		t.Errorf("storage read %d times for tampered value", store.reads-reads)
+	}
+
+	short := NewOptions(WithSigningKeys([]byte("short")))
+	if _, err := short.Parse(); err == nil {
+		t.Error("short signing key should be rejected")
+	}
+}
+
+// TestCookieAttributes testing cookie attributes and inconsistent combinations
+func TestCookieAttributes(t *testing.T) {
+	invalid := []Options{
+		NewOptions(WithSecure(false), WithSameSite(http.SameSiteNoneMode)),
+		NewOptions(WithSecure(false), WithPartitioned(true)),
+		NewOptions(WithSecure(false), WithCookieName("__Secure-sid")),
+		NewOptions(WithCookieName("__Host-sid"), WithDomain("ibyte.me")),
+		NewOptions(WithCookieName("__Host-sid"), WithPath("/app")),
+	}
+	for i := range invalid {
+		if _, err := invalid[i].Parse(); err == nil {
+			t.Errorf("options %d should be rejected", i)
+		}
+	}
+
+	opt := NewOptions(
+		WithCookieName("__Host-sid"),
+		WithSameSite(http.SameSiteNoneMode),
+		WithPartitioned(true),
+		WithBrowserSession(true),
+	)
+	m, err := NewManager(&opt, NewRAM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if _, err := m.GetSession(w, httptest.NewRequest(http.MethodGet, "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	header := w.Header().Get("Set-Cookie")
+	for _, attr := range []string{"__Host-sid=", "SameSite=None", "Secure", "Partitioned"} {
+		if !strings.Contains(header, attr) {
+			t.Errorf("Set-Cookie %q missing %s", header, attr)
+		}
+	}
+	if strings.Contains(header, "Max-Age") {
+		t.Errorf("browser session cookie has Max-Age: %q", header)
+	}
+}
+
+// TestFlashes testing flash messages consumed on read
+func TestFlashes(t *testing.T) {
+	opt := NewOptions()
+	m, _ := NewManager(&opt, NewRAM())
+	m.cfg.Codec = JSONCodec{}
+
+	s := m.NewSession()
+	s.AddFlash("info", "saved successfully")
+	s.AddFlash("error", &userInfo{UserName: "invalid"})
+
+	// simulate a redis round trip which loses Go types
+	data, _ := JSONCodec{}.Encode(s.record())
+	var r record
+	if err := (JSONCodec{}).Decode(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	s.restore(&r)
+	s.dirty = false
+
+	if msgs := s.Flashes("info"); len(msgs) != 1 || msgs[0] != "saved successfully" {
+		t.Errorf("Flashes() = %v", msgs)
+	}
+	if !s.dirty {
+		t.Error("reading flashes should mark session dirty")
+	}
+	if msgs := s.Flashes("info"); len(msgs) != 0 {
+		t.Errorf("flashes not consumed: %v", msgs)
+	}
+	if msgs := FlashesOf[*userInfo](s, "error"); len(msgs) != 1 || msgs[0].UserName != "invalid" {
+		t.Errorf("FlashesOf() = %v", msgs)
+	}
+
+	// concurrent requests of the same ram session do not share Values
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got Session
+			got.id, got.m = s.ID(), m
+			if err := m.Storage().Read(&got); err != nil {
+				t.Error(err)
+				return
+			}
+			got.AddFlash("info", "concurrent")
+			got.Flashes("info")
+		}()
+	}
+	wg.Wait()
 }
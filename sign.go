@@ -0,0 +1,89 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeValue return cookie value of session id, the value is signed
+// with the first signing key as id.issued.mac if signing is enabled.
+func (m *Manager) encodeValue(id string) string {
+	if len(m.cfg.SigningKeys) == 0 {
+		return id
+	}
+	payload := id + "." + strconv.FormatInt(time.Now().Unix(), 10)
+	return payload + "." + sign(m.cfg.SigningKeys[0], payload)
+}
+
+// decodeValue return session id of cookie value, signed value is
+// verified by all signing keys and rejected if tampered or too old.
+func (m *Manager) decodeValue(value string) (string, bool) {
+	if len(m.cfg.SigningKeys) == 0 {
+		return value, true
+	}
+
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, mac := value[:i], value[i+1:]
+
+	j := strings.LastIndexByte(payload, '.')
+	if j < 0 {
+		return "", false
+	}
+	id, issued := payload[:j], payload[j+1:]
+
+	verified := false
+	for _, key := range m.cfg.SigningKeys {
+		if hmac.Equal([]byte(mac), []byte(sign(key, payload))) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return "", false
+	}
+
+	unix, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if time.Since(time.Unix(unix, 0)) > m.cfg.LifeTime {
+		return "", false
+	}
+	return id, true
+}
+
+// sign return HMAC-SHA256 of payload with URL-safe encoding
+func sign(key []byte, payload string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,118 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"reflect"
+)
+
+// sessionOverhead is approximate bytes of session struct and store slots
+const sessionOverhead = 256
+
+// approxSize return approximate memory bytes of session,
+// values are measured recursively and shared pointers once.
+func approxSize(s *Session) int64 {
+	visited := make(map[uintptr]bool)
+	size := int64(sessionOverhead + len(s.id) + len(s.principal))
+	for attr, hash := range s.binding {
+		size += int64(len(attr) + len(hash))
+	}
+	for key, value := range s.Values {
+		size += int64(len(key))
+		if value != nil {
+			size += sizeValue(reflect.ValueOf(value), visited)
+		}
+	}
+	return size
+}
+
+// sizeValue return approximate memory bytes of value
+func sizeValue(v reflect.Value, visited map[uintptr]bool) int64 {
+	size := int64(v.Type().Size())
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return size
+		}
+		visited[v.Pointer()] = true
+		return size + sizeValue(v.Elem(), visited)
+	case reflect.Interface:
+		if v.IsNil() {
+			return size
+		}
+		return size + sizeValue(v.Elem(), visited)
+	case reflect.String:
+		return size + int64(v.Len())
+	case reflect.Map:
+		if v.IsNil() {
+			return size
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeValue(iter.Key(), visited) + sizeValue(iter.Value(), visited)
+		}
+		return size
+	case reflect.Slice:
+		if v.IsNil() {
+			return size
+		}
+		elem := v.Type().Elem()
+		if flat(elem) {
+			return size + int64(v.Cap())*int64(elem.Size())
+		}
+		size += int64(v.Cap()-v.Len()) * int64(elem.Size())
+		for i := 0; i < v.Len(); i++ {
+			size += sizeValue(v.Index(i), visited)
+		}
+		return size
+	case reflect.Array:
+		if flat(v.Type().Elem()) {
+			return size
+		}
+		size = 0
+		for i := 0; i < v.Len(); i++ {
+			size += sizeValue(v.Index(i), visited)
+		}
+		return size
+	case reflect.Struct:
+		size = 0
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeValue(v.Field(i), visited)
+		}
+		return size
+	default:
+		return size
+	}
+}
+
+// flat check whether type holds no pointers, so its size is fixed
+func flat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,266 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotMagic   = "GWSS" // Snapshot file magic
+	snapshotVersion = 1      // Snapshot file format version
+)
+
+var (
+	ErrSnapshotFormat   = errors.New("snapshot file format is illegal")
+	ErrSnapshotChecksum = errors.New("snapshot file checksum mismatch")
+)
+
+// Snapshot persist RamStore sessions to file across restarts.
+//
+// File layout, integers are big endian:
+//
+//	magic "GWSS" | version uint16 | count uint64 |
+//	count * (id length uvarint | id | data length uvarint | data) | crc32c uint32
+//
+// data is the session record encoded by Codec, the checksum covers all bytes before it.
+type Snapshot struct {
+	Path string `json:"path"`
+	// Interval write snapshot periodically, zero only writes on Close
+	Interval time.Duration `json:"interval"`
+	// Codec session data serializer, default GobCodec so that
+	// registered Values types survive restarts.
+	Codec Codec `json:"-"`
+	// OnError report snapshot load or save failure, a failed load starts empty
+	// and a session failed to encode is skipped.
+	OnError func(err error) `json:"-"`
+}
+
+// codec return snapshot codec
+func (s Snapshot) codec() Codec {
+	if s.Codec == nil {
+		return GobCodec{}
+	}
+	return s.Codec
+}
+
+// fail report snapshot error
+func (s Snapshot) fail(err error) {
+	debug.trace(err)
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Save write unexpired sessions to snapshot file, the file is
+// written to a temporary file and renamed over the old one.
+func (ram *RamStore) Save() error {
+	if ram.snapshot.Path == "" {
+		return errors.New("snapshot path is empty")
+	}
+	if err := ram.save(); err != nil {
+		err = fmt.Errorf("save snapshot %s: %w", ram.snapshot.Path, err)
+		ram.snapshot.fail(err)
+		return err
+	}
+	return nil
+}
+
+// save encode sessions of each shard and write snapshot file atomically
+func (ram *RamStore) save() error {
+	codec, now := ram.snapshot.codec(), time.Now()
+	var (
+		body    bytes.Buffer
+		count   uint64
+		buf     [binary.MaxVarintLen64]byte
+		skipped []error
+	)
+	// stored sessions are private copies replaced on write, so they
+	// are encoded under read lock without racing request handlers
+	for _, sh := range ram.shards {
+		sh.rw.RLock()
+		for sid, e := range sh.store {
+			if !now.Before(e.s.ExpireTime) {
+				continue
+			}
+			data, err := codec.Encode(e.s.record())
+			if err != nil {
+				skipped = append(skipped, fmt.Errorf("save snapshot %s: session %s: %w", ram.snapshot.Path, sid, err))
+				continue
+			}
+			body.Write(buf[:binary.PutUvarint(buf[:], uint64(len(sid)))])
+			body.WriteString(sid)
+			body.Write(buf[:binary.PutUvarint(buf[:], uint64(len(data)))])
+			body.Write(data)
+			count++
+		}
+		sh.rw.RUnlock()
+	}
+	for _, err := range skipped {
+		ram.snapshot.fail(err)
+	}
+
+	dir, base := filepath.Split(ram.snapshot.Path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := crc32.New(castagnoli)
+	w := bufio.NewWriter(io.MultiWriter(tmp, sum))
+	w.WriteString(snapshotMagic)
+	_ = binary.Write(w, binary.BigEndian, uint16(snapshotVersion))
+	_ = binary.Write(w, binary.BigEndian, count)
+	_, _ = body.WriteTo(w)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := binary.Write(tmp, binary.BigEndian, sum.Sum32()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ram.snapshot.Path); err != nil {
+		return err
+	}
+	// persist the rename, not supported by every platform
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	debug.trace(ram.snapshot.Path, count)
+	return nil
+}
+
+// restore load unexpired sessions from snapshot file, a missing file is not an error
+func (ram *RamStore) restore() {
+	data, err := os.ReadFile(ram.snapshot.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = ram.load(data)
+	}
+	if err != nil {
+		ram.snapshot.fail(fmt.Errorf("load snapshot %s: %w", ram.snapshot.Path, err))
+	}
+}
+
+// load verify snapshot data and put unexpired sessions,
+// nothing is loaded unless the whole file is valid.
+func (ram *RamStore) load(data []byte) error {
+	const header = len(snapshotMagic) + 2 + 8
+	if len(data) < header+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrSnapshotFormat
+	}
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(trailer) {
+		return ErrSnapshotChecksum
+	}
+	if version := binary.BigEndian.Uint16(body[4:6]); version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrSnapshotFormat, version)
+	}
+	count := binary.BigEndian.Uint64(body[6:header])
+
+	codec, now := ram.snapshot.codec(), time.Now()
+	r := bytes.NewReader(body[header:])
+	sessions := make([]*Session, 0)
+	for i := uint64(0); i < count; i++ {
+		sid, err := readChunk(r)
+		if err != nil {
+			return err
+		}
+		raw, err := readChunk(r)
+		if err != nil {
+			return err
+		}
+		var rec record
+		if err := codec.Decode(raw, &rec); err != nil {
+			return fmt.Errorf("session %s: %w", sid, err)
+		}
+		if !now.Before(rec.ExpireTime) {
+			continue
+		}
+		s := &Session{session{id: string(sid)}}
+		s.restore(&rec)
+		sessions = append(sessions, s)
+	}
+	if r.Len() != 0 {
+		return ErrSnapshotFormat
+	}
+	for _, s := range sessions {
+		ram.put(ram.shardOf(s.id), s)
+	}
+	debug.trace(ram.snapshot.Path, len(sessions))
+	return nil
+}
+
+// readChunk read uvarint length prefixed bytes
+func readChunk(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrSnapshotFormat
+	}
+	chunk := make([]byte, n)
+	_, _ = r.Read(chunk)
+	return chunk, nil
+}
+
+// persist write snapshot periodically until ram store is closed
+func (ram *RamStore) persist() {
+	if ram.snapshot.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(ram.snapshot.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ram.done:
+			return
+		case <-ticker.C:
+			_ = ram.Save()
+		}
+	}
+}
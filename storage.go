@@ -24,9 +24,11 @@ package gws
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -43,153 +45,407 @@ type Storage interface {
 	Remove(s *Session) (err error)
 }
 
-// timeout manager
-type tm map[string]*time.Timer
+// Regenerator storage which regenerates session id atomically.
+type Regenerator interface {
+	// Regenerate write new session and remove old session in one operation,
+	// old session stays readable for grace duration if grace is positive.
+	Regenerate(ctx context.Context, old, ns *Session, grace time.Duration) (err error)
+}
 
-// RamStore Local memory storage.
-type RamStore struct {
-	tm
-	rw           sync.RWMutex
-	store        map[string]*Session
-	garbageTruck chan string
+// PrincipalIndex storage which indexes sessions by principal id,
+// sessions are bound to a principal by Manager.Bind.
+type PrincipalIndex interface {
+	// ListUserSessions return session ids bound to the principal
+	ListUserSessions(ctx context.Context, principal string) ([]string, error)
+	// InvalidateUser remove all sessions bound to the principal
+	InvalidateUser(ctx context.Context, principal string) error
 }
 
-// NewRAM return local memory storage.
-func NewRAM() *RamStore {
-	s := &RamStore{
-		rw:           sync.RWMutex{},
-		store:        make(map[string]*Session),
-		tm:           make(map[string]*time.Timer, 1024),
-		garbageTruck: make(chan string, 1024),
-	}
-	go s.gc()
-	return s
+// ContextStorage session data store interface with caller context,
+// the context carries request cancellation and deadline to the storage.
+type ContextStorage interface {
+	// ReadContext read data from store
+	ReadContext(ctx context.Context, s *Session) (err error)
+	// WriteContext write data to storage
+	WriteContext(ctx context.Context, s *Session) (err error)
+	// RemoveContext remove data from storage
+	RemoveContext(ctx context.Context, s *Session) (err error)
 }
 
-func (ram *RamStore) Read(s *Session) (err error) {
-	ram.rw.RLock()
-	defer func() {
-		ram.rw.RUnlock()
-	}()
-	if session, ok := ram.store[s.id]; ok {
-		s.Values = session.Values
-		s.CreateTime = session.CreateTime
-		s.ExpireTime = session.ExpireTime
-		return nil
+// ContextAdapter return context storage of the storage.
+// If the storage does not implement ContextStorage,
+// the context is only checked before calling the storage.
+func ContextAdapter(store Storage) ContextStorage {
+	if cs, ok := store.(ContextStorage); ok {
+		return cs
 	}
-	debug.trace(s)
-	return ErrSessionNoData
+	return contextAdapter{store}
 }
 
-func (ram *RamStore) Write(s *Session) (err error) {
-	ram.rw.Lock()
-	defer ram.rw.Unlock()
-	ram.store[s.id] = s
+// contextAdapter adapt Storage to ContextStorage
+type contextAdapter struct {
+	Storage
+}
 
-	if ram.tm[s.id] == nil {
-		go func() {
-			ram.tm[s.id] = time.NewTimer(time.Until(s.ExpireTime))
-			<-ram.tm[s.id].C
-			ram.garbageTruck <- s.id
-			ram.tm[s.id].Stop()
-		}()
+func (ca contextAdapter) ReadContext(ctx context.Context, s *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-
-	debug.trace(s)
-	return nil
+	return ca.Read(s)
 }
 
-func (ram *RamStore) Remove(s *Session) (err error) {
-	ram.rw.Lock()
-	defer ram.rw.Unlock()
-	delete(ram.tm, s.id)
-	delete(ram.store, s.id)
-	debug.trace(s)
-	return nil
+func (ca contextAdapter) WriteContext(ctx context.Context, s *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.Write(s)
 }
 
-// gc is ram store garbage collection.
-func (ram *RamStore) gc() {
-	for {
-		select {
-		case sid := <-ram.garbageTruck:
-			ram.rw.Lock()
-			delete(ram.store, sid)
-			ram.rw.Unlock()
-		default:
-			debug.trace("gc running...")
-		}
+func (ca contextAdapter) RemoveContext(ctx context.Context, s *Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
+	return ca.Remove(s)
 }
 
 // RdsStore remote redis server storage.
 type RdsStore struct {
-	rw    sync.RWMutex
-	store *redis.Client
+	rw      sync.RWMutex
+	prefix  string
+	codec   Codec
+	store   *redis.Client
+	healthy int32
+	probing int32
+	db      int
+	events  bool
+	notify  notify
 }
 
-// NewRds return redis server storage.
+// NewRds return redis server storage by default manager config.
 func NewRds() *RdsStore {
-	return &RdsStore{
-		rw: sync.RWMutex{},
+	return NewRdsStore(std.cfg.RDSOption)
+}
+
+// NewRdsStore return redis server storage by option.
+func NewRdsStore(opt *RDSOption) *RdsStore {
+	codec := opt.Codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	rds := &RdsStore{
+		rw:      sync.RWMutex{},
+		healthy: 1,
+		codec:   codec,
+		prefix:  opt.Prefix,
+		db:      int(opt.Index),
+		events:  opt.ExpiryEvents,
 		store: redis.NewClient(&redis.Options{
-			Addr:     globalConfig.Address,
-			Password: globalConfig.Password,
-			DB:       int(globalConfig.Index),
-			PoolSize: int(globalConfig.PoolSize),
+			Addr:     opt.Address,
+			Password: opt.Password,
+			DB:       int(opt.Index),
+			PoolSize: int(opt.PoolSize),
 		}),
 	}
+	rds.notify.configure = opt.ConfigureEvents
+	rds.notify.onError = opt.OnEventsError
+	if rds.events {
+		rds.listen()
+		_ = rds.checkNotify()
+	}
+	return rds
 }
 
 func (rds *RdsStore) Read(s *Session) (err error) {
-	timeout, cancelFunc := timeoutCtx()
+	return rds.ReadContext(context.Background(), s)
+}
+
+func (rds *RdsStore) Write(s *Session) (err error) {
+	return rds.WriteContext(context.Background(), s)
+}
+
+func (rds *RdsStore) Remove(s *Session) (err error) {
+	return rds.RemoveContext(context.Background(), s)
+}
+
+func (rds *RdsStore) ReadContext(ctx context.Context, s *Session) (err error) {
+	timeout, cancelFunc := timeoutCtx(ctx)
 	rds.rw.RLock()
 	defer func() {
 		cancelFunc()
 		rds.rw.RUnlock()
 	}()
 	var val []byte
-	if val, err = rds.store.Get(timeout, formatPrefix(s.id)).Bytes(); err != nil {
-		return err
+	if val, err = rds.store.Get(timeout, rds.formatPrefix(s.id)).Bytes(); err != nil {
+		return rds.report(err)
 	}
+	rds.report(nil)
 	debug.trace(val)
-	return json.Unmarshal(val, s)
+	var r record
+	if err = rds.codec.Decode(val, &r); err != nil {
+		return err
+	}
+	s.restore(&r)
+	if s.principal != "" {
+		// touch last access for least recently used eviction
+		_ = rds.store.ZAddXX(timeout, rds.formatSeen(s.principal), &redis.Z{
+			Score:  float64(time.Now().UnixMilli()),
+			Member: s.id,
+		}).Err()
+	}
+	return nil
 }
 
-func (rds *RdsStore) Write(s *Session) (err error) {
-	bytes, err := json.Marshal(s)
+func (rds *RdsStore) WriteContext(ctx context.Context, s *Session) (err error) {
+	ttl := expire(s.ExpireTime)
+	if ttl.Milliseconds() <= 0 {
+		// already expired session is removed, redis has no negative ttl
+		return rds.RemoveContext(ctx, s)
+	}
+	bytes, err := rds.codec.Encode(s.record())
 	if err != nil {
 		return err
 	}
-	timeout, cancelFunc := timeoutCtx()
+	timeout, cancelFunc := timeoutCtx(ctx)
 	rds.rw.Lock()
 	defer func() {
 		cancelFunc()
 		rds.rw.Unlock()
 	}()
 	debug.trace(s)
-	return rds.store.Set(timeout, formatPrefix(s.id), bytes, expire(s.ExpireTime)).Err()
+	switch {
+	case s.principal != "":
+		keys := []string{rds.formatPrefix(s.id), rds.formatIndex(s.principal), rds.formatSeen(s.principal), rds.formatShadow(s.id)}
+		args := []interface{}{bytes, ttl.Milliseconds(), s.id, s.CreateTime.UnixMilli(), time.Now().UnixMilli(), rds.margin().Milliseconds()}
+		err = writeIndexScript.Run(timeout, rds.store, keys, args...).Err()
+	case rds.events:
+		_, err = rds.store.TxPipelined(timeout, func(pipe redis.Pipeliner) error {
+			pipe.Set(timeout, rds.formatPrefix(s.id), bytes, ttl+shadowMargin)
+			pipe.Set(timeout, rds.formatShadow(s.id), "", ttl)
+			return nil
+		})
+	default:
+		err = rds.store.Set(timeout, rds.formatPrefix(s.id), bytes, ttl).Err()
+	}
+	return rds.report(err)
 }
 
-func (rds *RdsStore) Remove(s *Session) (err error) {
-	timeout, cancelFunc := timeoutCtx()
+func (rds *RdsStore) RemoveContext(ctx context.Context, s *Session) (err error) {
+	timeout, cancelFunc := timeoutCtx(ctx)
 	rds.rw.Lock()
 	defer func() {
 		cancelFunc()
 		rds.rw.Unlock()
 	}()
 	debug.trace(s)
-	return rds.store.Del(timeout, formatPrefix(s.id)).Err()
+	if s.principal == "" {
+		return rds.report(rds.store.Del(timeout, rds.formatPrefix(s.id)).Err())
+	}
+	_, err = rds.store.TxPipelined(timeout, func(pipe redis.Pipeliner) error {
+		pipe.Del(timeout, rds.formatPrefix(s.id))
+		pipe.ZRem(timeout, rds.formatIndex(s.principal), s.id)
+		pipe.ZRem(timeout, rds.formatSeen(s.principal), s.id)
+		return nil
+	})
+	return rds.report(err)
+}
+
+// writeIndexScript write session and add it to principal index,
+// index ttl is extended to the longest session ttl.
+// KEYS: session key, index key, seen key, shadow key;
+// ARGV: data, ttl ms, session id, create time ms, now ms, shadow margin ms.
+var writeIndexScript = redis.NewScript(`
+local margin = tonumber(ARGV[6])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', tonumber(ARGV[2]) + margin)
+if margin > 0 then
+	redis.call('SET', KEYS[4], '', 'PX', ARGV[2])
+end
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[3])
+redis.call('ZADD', KEYS[3], ARGV[5], ARGV[3])
+for i = 2, 3 do
+	if redis.call('PTTL', KEYS[i]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// regenerateScript write new session and expire old session atomically,
+// KEYS: old key, new key, index key, seen key, old shadow key, new shadow key;
+// ARGV: new data, new ttl ms, grace ms, old id, new id, create time ms, principal, now ms, shadow margin ms.
+var regenerateScript = redis.NewScript(`
+local margin = tonumber(ARGV[9])
+redis.call('SET', KEYS[2], ARGV[1], 'PX', tonumber(ARGV[2]) + margin)
+if margin > 0 then
+	redis.call('SET', KEYS[6], '', 'PX', ARGV[2])
+end
+if ARGV[7] ~= '' then
+	redis.call('ZADD', KEYS[3], ARGV[6], ARGV[5])
+	redis.call('ZADD', KEYS[4], ARGV[8], ARGV[5])
+	for i = 3, 4 do
+		if redis.call('PTTL', KEYS[i]) < tonumber(ARGV[2]) then
+			redis.call('PEXPIRE', KEYS[i], ARGV[2])
+		end
+	end
+end
+local grace = tonumber(ARGV[3])
+if grace <= 0 then
+	redis.call('ZREM', KEYS[3], ARGV[4])
+	redis.call('ZREM', KEYS[4], ARGV[4])
+	return redis.call('DEL', KEYS[1], KEYS[5])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -1 or ttl > grace + margin then
+	redis.call('PEXPIRE', KEYS[1], grace + margin)
+end
+if margin > 0 and redis.call('PTTL', KEYS[5]) > grace then
+	redis.call('PEXPIRE', KEYS[5], grace)
+end
+return 1
+`)
+
+// Regenerate write new session and remove or expire old session by one script
+func (rds *RdsStore) Regenerate(ctx context.Context, old, ns *Session, grace time.Duration) (err error) {
+	bytes, err := rds.codec.Encode(ns.record())
+	if err != nil {
+		return err
+	}
+	ttl := expire(ns.ExpireTime).Milliseconds()
+	if ttl <= 0 {
+		return ErrSessionNoData
+	}
+	timeout, cancelFunc := timeoutCtx(ctx)
+	rds.rw.Lock()
+	defer func() {
+		cancelFunc()
+		rds.rw.Unlock()
+	}()
+	debug.trace(old, ns)
+	keys := []string{
+		rds.formatPrefix(old.id), rds.formatPrefix(ns.id), rds.formatIndex(ns.principal), rds.formatSeen(ns.principal),
+		rds.formatShadow(old.id), rds.formatShadow(ns.id),
+	}
+	args := []interface{}{
+		bytes, ttl, grace.Milliseconds(), old.id, ns.id, ns.CreateTime.UnixMilli(), ns.principal,
+		time.Now().UnixMilli(), rds.margin().Milliseconds(),
+	}
+	return rds.report(regenerateScript.Run(timeout, rds.store, keys, args...).Err())
+}
+
+// listIndexScript return live session ids of principal and remove expired ones,
+// KEYS: index key, seen key; ARGV: live key prefix, see livePrefix.
+var listIndexScript = redis.NewScript(`
+local live = {}
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	if redis.call('EXISTS', ARGV[1] .. id) == 1 then
+		table.insert(live, id)
+	else
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('ZREM', KEYS[2], id)
+	end
+end
+return live
+`)
+
+// invalidateIndexScript remove all sessions of principal and the index,
+// KEYS: index key, seen key; ARGV: session key prefix.
+var invalidateIndexScript = redis.NewScript(`
+local ids = redis.call('ZRANGE', KEYS[1], 0, -1)
+for _, id in ipairs(ids) do
+	redis.call('DEL', ARGV[1] .. id)
+end
+redis.call('DEL', KEYS[1], KEYS[2])
+return #ids
+`)
+
+// ListUserSessions return session ids bound to the principal
+func (rds *RdsStore) ListUserSessions(ctx context.Context, principal string) ([]string, error) {
+	timeout, cancelFunc := timeoutCtx(ctx)
+	defer cancelFunc()
+	ids, err := listIndexScript.Run(timeout, rds.store, rds.indexKeys(principal), rds.livePrefix()).StringSlice()
+	if err == redis.Nil {
+		return nil, rds.report(nil)
+	}
+	return ids, rds.report(err)
+}
+
+// InvalidateUser remove all sessions bound to the principal
+func (rds *RdsStore) InvalidateUser(ctx context.Context, principal string) error {
+	timeout, cancelFunc := timeoutCtx(ctx)
+	defer cancelFunc()
+	return rds.report(invalidateIndexScript.Run(timeout, rds.store, rds.indexKeys(principal), rds.formatPrefix("")).Err())
+}
+
+// Healthy return whether the redis server is reachable
+func (rds *RdsStore) Healthy() bool {
+	return atomic.LoadInt32(&rds.healthy) == 1
+}
+
+// report update health status by command result
+func (rds *RdsStore) report(err error) error {
+	var ne net.Error
+	switch {
+	case err == nil || err == redis.Nil:
+		atomic.StoreInt32(&rds.healthy, 1)
+	case errors.As(err, &ne):
+		rds.unhealthy()
+	}
+	return err
+}
+
+// unhealthy mark store unhealthy and probe server until reachable
+func (rds *RdsStore) unhealthy() {
+	atomic.StoreInt32(&rds.healthy, 0)
+	if !atomic.CompareAndSwapInt32(&rds.probing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&rds.probing, 0)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if rds.Healthy() {
+				break
+			}
+			timeout, cancelFunc := timeoutCtx(context.Background())
+			err := rds.store.Ping(timeout).Err()
+			cancelFunc()
+			if err == nil {
+				atomic.StoreInt32(&rds.healthy, 1)
+				break
+			}
+			debug.trace(err)
+		}
+		// server config may be unset at start or lost on restart
+		_ = rds.checkNotify()
+	}()
 }
 
 // formatPrefix format redis key prefix
-func formatPrefix(sid string) string {
-	return fmt.Sprintf("%s:%s", globalConfig.Prefix, sid)
+func (rds *RdsStore) formatPrefix(sid string) string {
+	return fmt.Sprintf("%s:%s", rds.prefix, sid)
 }
 
-// timeoutCtx redis connect timeout
-func timeoutCtx() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
+// formatIndex format redis principal index key
+func (rds *RdsStore) formatIndex(principal string) string {
+	return fmt.Sprintf("%s:user:%s", rds.prefix, principal)
+}
+
+// formatSeen format redis principal last access key
+func (rds *RdsStore) formatSeen(principal string) string {
+	return fmt.Sprintf("%s:user:%s:seen", rds.prefix, principal)
+}
+
+// indexKeys return principal index and last access keys
+func (rds *RdsStore) indexKeys(principal string) []string {
+	return []string{rds.formatIndex(principal), rds.formatSeen(principal)}
+}
+
+// timeoutCtx redis connect timeout, caller deadline takes precedence
+func timeoutCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(3)*time.Second)
 }
 
 // expire redis key expire
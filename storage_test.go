@@ -0,0 +1,665 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newRdsManager return manager of redis storage backed by miniredis
+func newRdsManager(t *testing.T, opts ...func(*Options)) (*Manager, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("passwd")
+	host, port := mr.Host(), mr.Server().Addr().Port
+	opt := NewRDSOptions(host, uint16(port), "passwd", WithOpts(NewOptions(opts...)))
+	m, err := NewManager(opt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, mr
+}
+
+// TestRegenerate testing atomic session id regeneration
+func TestRegenerate(t *testing.T) {
+	rdsm, mr := newRdsManager(t)
+	opt := NewOptions()
+	ramm, _ := NewManager(&opt, NewRAM())
+
+	for name, m := range map[string]*Manager{"rds": rdsm, "ram": ramm} {
+		t.Run(name, func(t *testing.T) {
+			old := m.NewSession()
+			user := &userInfo{UserName: "Leon Ding"}
+			old.Values["user"] = user
+			if err := old.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			ns, err := m.Regenerate(httptest.NewRecorder(), old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ns.ID() == old.ID() {
+				t.Fatal("session id not regenerated")
+			}
+			if got, ok := ns.Values["user"].(*userInfo); !ok || got == user || got.UserName != user.UserName {
+				t.Errorf("values not deep copied: %#v", ns.Values["user"])
+			}
+
+			var s Session
+			s.id = old.ID()
+			if err := m.Storage().Read(&s); err == nil {
+				t.Error("old session still readable")
+			}
+			s.id = ns.ID()
+			if err := m.Storage().Read(&s); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// old session stays readable for grace window
+	rdsm.cfg.RegenerateGrace = 5 * time.Second
+	old := rdsm.NewSession()
+	_ = old.Sync()
+	w := httptest.NewRecorder()
+	if _, err := rdsm.Regenerate(w, old); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.DB(int(rdsm.cfg.Index)).TTL(rdsm.Storage().(*RdsStore).formatPrefix(old.ID())); ttl <= 0 || ttl > 5*time.Second {
+		t.Errorf("old session ttl = %v, want grace window", ttl)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != rdsm.cfg.CookieName {
+		t.Errorf("new session cookie not set: %v", cookies)
+	}
+
+	// ram grace window shortens stored copy, not the caller's old session
+	ramm.cfg.RegenerateGrace = 5 * time.Second
+	old = ramm.NewSession()
+	_ = old.Sync()
+	expireTime := old.ExpireTime
+	if _, err := ramm.Regenerate(httptest.NewRecorder(), old); err != nil {
+		t.Fatal(err)
+	}
+	if !old.ExpireTime.Equal(expireTime) {
+		t.Errorf("old session ExpireTime mutated to %v", old.ExpireTime)
+	}
+	var stored Session
+	stored.id = old.ID()
+	if err := ramm.Storage().Read(&stored); err != nil || stored.ExpireTime.After(time.Now().Add(5*time.Second)) {
+		t.Errorf("old session not in grace window: %v %v", err, stored.ExpireTime)
+	}
+}
+
+// TestInvalidateUser testing principal index and log out everywhere
+func TestInvalidateUser(t *testing.T) {
+	rdsm, _ := newRdsManager(t)
+	opt := NewOptions()
+	ramm, _ := NewManager(&opt, NewRAM())
+
+	for name, m := range map[string]*Manager{"rds": rdsm, "ram": ramm} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			a, b, other := m.NewSession(), m.NewSession(), m.NewSession()
+			for s, principal := range map[*Session]string{a: "leon", b: "leon", other: "ding"} {
+				if err := m.Bind(s, principal); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ns, err := m.Regenerate(httptest.NewRecorder(), a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ns.Principal() != "leon" {
+				t.Errorf("principal not migrated: %q", ns.Principal())
+			}
+
+			ids, err := m.ListUserSessions(ctx, "leon")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(ids)
+			want := []string{b.ID(), ns.ID()}
+			sort.Strings(want)
+			if !reflect.DeepEqual(ids, want) {
+				t.Errorf("ListUserSessions = %v, want %v", ids, want)
+			}
+
+			if err := m.InvalidateUser(ctx, "leon"); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []*Session{b, ns} {
+				var got Session
+				got.id = s.ID()
+				if m.Storage().Read(&got) == nil {
+					t.Errorf("session %s not invalidated", s.ID())
+				}
+			}
+			if ids, _ := m.ListUserSessions(ctx, "leon"); len(ids) != 0 {
+				t.Errorf("index not cleared: %v", ids)
+			}
+			var got Session
+			got.id = other.ID()
+			if err := m.Storage().Read(&got); err != nil || got.Principal() != "ding" {
+				t.Errorf("other principal session affected: %v %q", err, got.Principal())
+			}
+		})
+	}
+}
+
+// TestRdsWriteExpired testing session saved after expire time is removed
+func TestRdsWriteExpired(t *testing.T) {
+	m, mr := newRdsManager(t)
+	s := m.NewSession()
+	if err := m.Bind(s, "leon"); err != nil {
+		t.Fatal(err)
+	}
+	s.ExpireTime = time.Now().Add(-time.Second)
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if mr.DB(int(m.cfg.Index)).Exists(m.Storage().(*RdsStore).formatPrefix(s.ID())) {
+		t.Error("expired session still stored")
+	}
+	if ids, _ := m.ListUserSessions(context.Background(), "leon"); len(ids) != 0 {
+		t.Errorf("expired session still indexed: %v", ids)
+	}
+}
+
+// TestSessionLimit testing concurrent session limit policies
+func TestSessionLimit(t *testing.T) {
+	for _, policy := range []LimitPolicy{RejectNew, EvictOldest, EvictLRU} {
+		rdsm, _ := newRdsManager(t, WithMaxSessions(2, policy))
+		opt := NewOptions(WithMaxSessions(2, policy))
+		ramm, _ := NewManager(&opt, NewRAM())
+
+		for name, m := range map[string]*Manager{"rds": rdsm, "ram": ramm} {
+			t.Run(name+"/"+policy.String(), func(t *testing.T) {
+				var first, second *Session
+				for _, s := range []**Session{&first, &second} {
+					*s = m.NewSession()
+					if err := m.Bind(*s, "leon"); err != nil {
+						t.Fatal(err)
+					}
+					time.Sleep(2 * time.Millisecond)
+				}
+				// rebinding a bound session does not count twice
+				if err := m.Bind(first, "leon"); err != nil {
+					t.Fatal(err)
+				}
+				// touch first session so second is least recently used
+				time.Sleep(2 * time.Millisecond)
+				var touch Session
+				touch.id = first.ID()
+				_ = m.cs().ReadContext(context.Background(), &touch)
+
+				third := m.NewSession()
+				err := m.Bind(third, "leon")
+				ids, _ := m.ListUserSessions(context.Background(), "leon")
+				sort.Strings(ids)
+
+				var want []string
+				switch policy {
+				case RejectNew:
+					if !errors.Is(err, ErrSessionLimit) || third.Principal() != "" {
+						t.Fatalf("Bind = %v, principal %q, want ErrSessionLimit", err, third.Principal())
+					}
+					want = []string{first.ID(), second.ID()}
+				case EvictOldest:
+					want = []string{second.ID(), third.ID()}
+				case EvictLRU:
+					want = []string{first.ID(), third.ID()}
+				}
+				if policy != RejectNew && err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(want)
+				if !reflect.DeepEqual(ids, want) {
+					t.Errorf("sessions = %v, want %v", ids, want)
+				}
+			})
+		}
+	}
+}
+
+// TestExpiryEvents testing redis expired keyevent with shadow key
+func TestExpiryEvents(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("passwd")
+	opt := NewRDSOptions(mr.Host(), uint16(mr.Server().Addr().Port), "passwd", WithExpiryEvents(true))
+	m, err := NewManager(opt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := m.Storage().(*RdsStore)
+	defer rdb.Close()
+
+	events := make(chan *Event, 2)
+	m.On(EventExpire, func(ctx context.Context, e *Event) {
+		events <- e
+	})
+
+	s := m.NewSession()
+	s.Values["user"] = "leon"
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	db := mr.DB(int(m.cfg.Index))
+	if shadow, data := db.TTL(rdb.formatShadow(s.ID())), db.TTL(rdb.formatPrefix(s.ID())); shadow <= 0 || data < shadow+shadowMargin/2 {
+		t.Fatalf("shadow ttl %v, data ttl %v", shadow, data)
+	}
+
+	// miniredis does not emit keyspace notifications, publish the expired shadow key
+	channel := fmt.Sprintf("__keyevent@%d__:expired", m.cfg.Index)
+	for i := 0; mr.Publish(channel, rdb.formatShadow(s.ID())) == 0; i++ {
+		if i > 100 {
+			t.Fatal("expired event not subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case e := <-events:
+		if e.Session.ID() != s.ID() || e.Session.Values["user"] != "leon" {
+			t.Errorf("expired session = %s %v", e.Session.ID(), e.Session.Values)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expire event not fired")
+	}
+	if db.Exists(rdb.formatPrefix(s.ID())) {
+		t.Error("expired session data not claimed")
+	}
+
+	// claimed data is reported only once
+	mr.Publish(channel, rdb.formatShadow(s.ID()))
+	select {
+	case e := <-events:
+		t.Errorf("duplicate expire event %s", e.Session.ID())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestExpiryEventsLimit testing sessions past their shadow key are not live
+func TestExpiryEventsLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("passwd")
+	opt := NewRDSOptions(mr.Host(), uint16(mr.Server().Addr().Port), "passwd",
+		WithOpts(NewOptions(WithMaxSessions(2, RejectNew))), WithExpiryEvents(true))
+	m, err := NewManager(opt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := m.Storage().(*RdsStore)
+	defer rdb.Close()
+
+	ctx := context.Background()
+	expired, live := m.NewSession(), m.NewSession()
+	for _, s := range []*Session{expired, live} {
+		if err := m.Bind(s, "leon"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// shadow key expired, data stays for shadowMargin until claimed
+	db := mr.DB(int(m.cfg.Index))
+	db.Del(rdb.formatShadow(expired.ID()))
+	if !db.Exists(rdb.formatPrefix(expired.ID())) {
+		t.Fatal("session data should outlive shadow key")
+	}
+
+	if ids, _ := m.ListUserSessions(ctx, "leon"); !reflect.DeepEqual(ids, []string{live.ID()}) {
+		t.Errorf("ListUserSessions = %v, want [%s]", ids, live.ID())
+	}
+	third := m.NewSession()
+	if err := m.Bind(third, "leon"); err != nil {
+		t.Errorf("Bind = %v, expired session counted against limit", err)
+	}
+}
+
+// TestEventsConfig testing expired keyevent config is opt-in and failures are reported
+func TestEventsConfig(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("passwd")
+	reported := make(chan error, 4)
+	newOpt := func(opts ...func(*RDSOption)) *RDSOption {
+		opts = append(opts, WithExpiryEvents(true), WithEventsError(func(err error) { reported <- err }))
+		return NewRDSOptions(mr.Host(), uint16(mr.Server().Addr().Port), "passwd", opts...)
+	}
+
+	// miniredis has no CONFIG command, failure is reported instead of swallowed
+	m, err := NewManager(newOpt(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := m.Storage().(*RdsStore)
+	defer rdb.Close()
+	select {
+	case err := <-reported:
+		if !strings.Contains(err.Error(), "notify-keyspace-events") {
+			t.Errorf("reported %v", err)
+		}
+	default:
+		t.Fatal("events failure not reported")
+	}
+
+	// checked again when the server recovers
+	rdb.unhealthy()
+	select {
+	case <-reported:
+	case <-time.After(3 * time.Second):
+		t.Error("events not checked after recovery")
+	}
+
+	// opt-in server config failure fails the manager
+	if _, err := NewManager(newOpt(WithConfigureEvents(true)), nil); err == nil {
+		t.Error("NewManager should fail when server config cannot be written")
+	}
+}
+
+// TestRamExpiry testing ram store expiry scheduler with renewal and removal
+func TestRamExpiry(t *testing.T) {
+	ram := NewRAM()
+	defer ram.Close()
+	expired := make(chan string, 64)
+	ram.OnExpire(func(s *Session) {
+		expired <- s.ID()
+	})
+
+	now := time.Now()
+	sessions := make([]*Session, 30)
+	for i := range sessions {
+		s := &Session{session{id: fmt.Sprint(i), CreateTime: now, ExpireTime: now.Add(50 * time.Millisecond)}}
+		sessions[i] = s
+		_ = ram.Write(s)
+	}
+	// renew first ten, remove next ten
+	for _, s := range sessions[:10] {
+		_ = ram.Write(&Session{session{id: s.id, CreateTime: now, ExpireTime: now.Add(time.Hour)}})
+	}
+	for _, s := range sessions[10:20] {
+		_ = ram.Remove(s)
+	}
+
+	got := make(map[string]bool)
+	timeout := time.After(3 * time.Second)
+	for len(got) < 10 {
+		select {
+		case sid := <-expired:
+			got[sid] = true
+		case <-timeout:
+			t.Fatalf("expired %d sessions, want 10", len(got))
+		}
+	}
+	for _, s := range sessions[20:] {
+		if !got[s.ID()] {
+			t.Errorf("session %s not expired", s.ID())
+		}
+	}
+	for _, s := range sessions[:10] {
+		if err := ram.Read(&Session{session{id: s.id}}); err != nil {
+			t.Errorf("renewed session %s expired", s.ID())
+		}
+	}
+
+	// stopped store no longer expires sessions
+	_ = ram.Close()
+	_ = ram.Write(&Session{session{id: "stopped", ExpireTime: time.Now()}})
+	select {
+	case sid := <-expired:
+		t.Errorf("session %s expired after Close", sid)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRamDetach testing ram store does not keep request references of session
+func TestRamDetach(t *testing.T) {
+	opt := NewOptions()
+	m, _ := NewManager(&opt, NewRAM())
+	defer m.Close()
+	s, err := m.GetSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	ram := m.Storage().(*RamStore)
+	stored := ram.shardOf(s.ID()).store[s.ID()].s
+	if stored == s || stored.m != nil || stored.w != nil || stored.req != nil || stored.next != nil {
+		t.Errorf("stored session keeps references: %+v", stored.session)
+	}
+
+	// values are copied, modifications need Sync for ram store too
+	s.Values["user"] = "leon"
+	var got Session
+	got.id = s.ID()
+	if err := ram.Read(&got); err != nil || got.Values["user"] != nil {
+		t.Errorf("unsynced value visible: %v %v", err, got.Values)
+	}
+}
+
+// TestRamCapacity testing ram store capacity eviction and stats
+func TestRamCapacity(t *testing.T) {
+	for _, eviction := range []Eviction{EvictionLRU, EvictionLFU} {
+		t.Run(eviction.String(), func(t *testing.T) {
+			opt := NewOptions(WithCapacity(Capacity{MaxEntries: 3, Eviction: eviction}))
+			m, err := NewManager(&opt, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			var evicted []string
+			m.On(EventEvict, func(ctx context.Context, e *Event) {
+				evicted = append(evicted, e.Session.ID())
+			})
+
+			ram := m.Storage().(*RamStore)
+			write := func(sid string) {
+				_ = ram.Write(&Session{session{id: sid, ExpireTime: time.Now().Add(time.Hour)}})
+			}
+			read := func(sid string) {
+				_ = ram.Read(&Session{session{id: sid}})
+			}
+			write("a")
+			write("b")
+			write("c")
+			// a is recently and frequently used, b is neither
+			read("a")
+			read("a")
+			read("c")
+			time.Sleep(time.Millisecond)
+			read("c")
+			write("d")
+
+			if !reflect.DeepEqual(evicted, []string{"b"}) {
+				t.Errorf("evicted = %v, want [b]", evicted)
+			}
+			if stats := ram.Stats(); stats.Sessions != 3 || stats.Evictions != 1 || stats.Bytes != 0 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+
+	ram := NewRAM(WithRAMCapacity(Capacity{MaxBytes: 64 << 10}))
+	defer ram.Close()
+	for i := 0; i < 10; i++ {
+		_ = ram.Write(&Session{session{
+			id:         fmt.Sprint(i),
+			ExpireTime: time.Now().Add(time.Hour),
+			Values:     Values{"blob": make([]byte, 16<<10)},
+		}})
+	}
+	if stats := ram.Stats(); stats.Bytes > 64<<10 || stats.Sessions != 3 || stats.Evictions != 7 {
+		t.Errorf("stats = %+v, want bounded by 64KiB", stats)
+	}
+	for _, sid := range []string{"a", "1"} {
+		_ = ram.Remove(&Session{session{id: sid}})
+	}
+	if stats := ram.Stats(); stats.Sessions != 3 {
+		t.Errorf("sessions = %d after removing missing session", stats.Sessions)
+	}
+}
+
+// TestRamConcurrentValues testing concurrent requests of one session do not share Values,
+// run with -race.
+func TestRamConcurrentValues(t *testing.T) {
+	ram := NewRAM(WithRAMCapacity(Capacity{MaxBytes: 1 << 20}))
+	defer ram.Close()
+	_ = ram.Write(&Session{session{id: "shared", ExpireTime: time.Now().Add(time.Hour), Values: Values{}}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s := &Session{session{id: "shared"}}
+				if err := ram.Read(s); err != nil {
+					t.Error(err)
+					return
+				}
+				runtime.Gosched()
+				s.Values[fmt.Sprint(i)] = j
+				_ = ram.Write(s)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats := ram.Stats(); stats.Sessions != 1 || stats.Bytes <= 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+// BenchmarkRamStore benchmark ram store lock contention by shard count,
+// run with -cpu 1,4,16,64 to compare scaling across GOMAXPROCS.
+func BenchmarkRamStore(b *testing.B) {
+	const sessions = 1 << 14
+	for _, shards := range []int{1, 32, 256} {
+		ram := NewRAM(WithRAMShards(shards))
+		ids := make([]string, sessions)
+		for i := range ids {
+			ids[i] = RandomID{}.Generate()
+			_ = ram.Write(&Session{session{id: ids[i], Values: Values{"n": i}, ExpireTime: time.Now().Add(time.Hour)}})
+		}
+		for _, bench := range []struct {
+			name   string
+			writes int // writes per 10 operations
+		}{{"read", 0}, {"mixed", 2}, {"write", 10}} {
+			b.Run(fmt.Sprintf("shards=%d/%s", shards, bench.name), func(b *testing.B) {
+				var seq uint32
+				b.RunParallel(func(pb *testing.PB) {
+					i := int(atomic.AddUint32(&seq, 7919))
+					s := &Session{session{ExpireTime: time.Now().Add(time.Hour)}}
+					for pb.Next() {
+						i++
+						s.id = ids[i%sessions]
+						if i%10 < bench.writes {
+							_ = ram.Write(&Session{session{id: s.id, Values: Values{"n": i}, ExpireTime: s.ExpireTime}})
+						} else {
+							_ = ram.Read(s)
+						}
+					}
+				})
+			})
+		}
+		_ = ram.Close()
+	}
+}
+
+// TestRamSnapshot testing ram store snapshot and restore across restarts
+func TestRamSnapshot(t *testing.T) {
+	Register(&userInfo{})
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	var failures []error
+	snapshot := Snapshot{Path: path, OnError: func(err error) { failures = append(failures, err) }}
+
+	ram := NewRAM(WithRAMSnapshot(snapshot))
+	live := &Session{session{
+		id:         "live",
+		principal:  "leon",
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		Values:     Values{"user": &userInfo{UserName: "Leon Ding", Age: 21}},
+	}}
+	_ = ram.Write(live)
+	_ = ram.Write(&Session{session{id: "expiring", ExpireTime: time.Now().Add(50 * time.Millisecond)}})
+	// session failed to encode is skipped and reported
+	_ = ram.Write(&Session{session{id: "broken", ExpireTime: time.Now().Add(time.Hour), Values: Values{"ch": make(chan int)}}})
+	if err := ram.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "broken") {
+		t.Errorf("failures = %v, want broken session reported", failures)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := ram.Close(); err != nil {
+		t.Fatal(err)
+	}
+	failures = nil
+
+	restored := NewRAM(WithRAMSnapshot(snapshot))
+	defer restored.Close()
+	s := &Session{session{id: "live"}}
+	if err := restored.Read(s); err != nil {
+		t.Fatal(err)
+	}
+	if user, ok := s.Values["user"].(*userInfo); !ok || user.UserName != "Leon Ding" || s.Principal() != "leon" {
+		t.Errorf("restored session = %#v %q", s.Values["user"], s.Principal())
+	}
+	if ids, _ := restored.ListUserSessions(context.Background(), "leon"); len(ids) != 1 {
+		t.Errorf("principal index not restored: %v", ids)
+	}
+	if restored.Read(&Session{session{id: "expiring"}}) == nil || restored.Stats().Sessions != 1 {
+		t.Error("expired or broken session restored")
+	}
+
+	// corrupted snapshot is reported and not loaded
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 0xff
+	_ = os.WriteFile(path, data, 0600)
+	corrupted := NewRAM(WithRAMSnapshot(snapshot))
+	defer corrupted.Close()
+	if len(failures) != 1 || !errors.Is(failures[0], ErrSnapshotChecksum) {
+		t.Errorf("failures = %v, want checksum mismatch", failures)
+	}
+	if corrupted.Stats().Sessions != 0 {
+		t.Error("corrupted snapshot loaded")
+	}
+	if matches, _ := filepath.Glob(path + ".tmp*"); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
@@ -0,0 +1,145 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Transport session token carrier interface.
+// You can customize how the session token travels by implementing this interface.
+type Transport interface {
+	// Extract return session token of the name from request
+	Extract(req *http.Request, name string) (string, bool)
+	// Inject write session token to response, the cookie carries the
+	// token name, value, max age and the manager cookie attributes.
+	// Negative MaxAge means the token is removed.
+	Inject(w http.ResponseWriter, cookie *http.Cookie)
+}
+
+// CookieTransport carry session token by cookie, the default transport.
+type CookieTransport struct{}
+
+func (CookieTransport) Extract(req *http.Request, name string) (string, bool) {
+	cookie, err := req.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+func (CookieTransport) Inject(w http.ResponseWriter, cookie *http.Cookie) {
+	writeCookie(w, cookie)
+}
+
+// HeaderTransport carry session token by request header, e.g.
+// Authorization: Bearer <token>, for clients which cannot use cookies.
+type HeaderTransport struct {
+	// Name is request header name
+	Name string
+	// Scheme is optional token scheme, e.g. Bearer
+	Scheme string
+	// Response is response header name of new token, default Name
+	Response string
+}
+
+// BearerTransport return Authorization Bearer header transport,
+// new token is sent by X-Session-Token response header.
+func BearerTransport() HeaderTransport {
+	return HeaderTransport{Name: "Authorization", Scheme: "Bearer", Response: "X-Session-Token"}
+}
+
+func (ht HeaderTransport) Extract(req *http.Request, _ string) (string, bool) {
+	value := strings.TrimSpace(req.Header.Get(ht.Name))
+	if ht.Scheme != "" {
+		if len(value) <= len(ht.Scheme) || !strings.EqualFold(value[:len(ht.Scheme)], ht.Scheme) || value[len(ht.Scheme)] != ' ' {
+			return "", false
+		}
+		value = strings.TrimSpace(value[len(ht.Scheme)+1:])
+	}
+	return value, value != ""
+}
+
+func (ht HeaderTransport) Inject(w http.ResponseWriter, cookie *http.Cookie) {
+	name := ht.Response
+	if name == "" {
+		name = ht.Name
+	}
+	if cookie.MaxAge < 0 {
+		w.Header().Set(name, "")
+		return
+	}
+	w.Header().Set(name, cookie.Value)
+}
+
+// QueryTransport carry session token by URL query parameter,
+// it is read only, new token must be delivered by the application.
+type QueryTransport struct {
+	// Param is query parameter name
+	Param string
+}
+
+func (qt QueryTransport) Extract(req *http.Request, _ string) (string, bool) {
+	value := req.URL.Query().Get(qt.Param)
+	return value, value != ""
+}
+
+func (QueryTransport) Inject(http.ResponseWriter, *http.Cookie) {}
+
+// chain is chained transports
+type chain []Transport
+
+// Chain return transport which extracts token by the first transport
+// that carries it and injects token to all transports,
+// e.g. Chain(BearerTransport(), CookieTransport{}).
+func Chain(transports ...Transport) Transport {
+	return chain(transports)
+}
+
+func (c chain) Extract(req *http.Request, name string) (string, bool) {
+	for _, t := range c {
+		if value, ok := t.Extract(req, name); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (c chain) Inject(w http.ResponseWriter, cookie *http.Cookie) {
+	for _, t := range c {
+		cc := *cookie
+		t.Inject(w, &cc)
+	}
+}
+
+// writeCookie set cookie with unparsed attributes, e.g. Partitioned
+func writeCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	if len(cookie.Unparsed) == 0 {
+		http.SetCookie(w, cookie)
+		return
+	}
+	if v := cookie.String(); v != "" {
+		w.Header().Add("Set-Cookie", v+"; "+strings.Join(cookie.Unparsed, "; "))
+	}
+}
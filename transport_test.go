@@ -0,0 +1,73 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTransport testing header first and cookie fallback transport
+func TestTransport(t *testing.T) {
+	opt := NewOptions(WithTransport(Chain(BearerTransport(), CookieTransport{})))
+	m, err := NewManager(&opt, NewRAM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s, _ := m.GetSession(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	token := w.Header().Get("X-Session-Token")
+	if token != s.ID() || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("token not injected to all transports: %q %v", token, w.Result().Cookies())
+	}
+
+	tests := []struct {
+		name  string
+		setup func(req *http.Request)
+		same  bool
+	}{
+		{"bearer", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }, true},
+		{"cookie", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: opt.CookieName, Value: token}) }, true},
+		{"scheme", func(req *http.Request) { req.Header.Set("Authorization", "Basic "+token) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(req)
+			got, err := m.GetSession(httptest.NewRecorder(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got.ID() == s.ID()) != tt.same {
+				t.Errorf("GetSession() id = %s, session %s", got.ID(), s.ID())
+			}
+		})
+	}
+
+	q := QueryTransport{Param: "sid"}
+	if v, ok := q.Extract(httptest.NewRequest(http.MethodGet, "/?sid="+token, nil), ""); !ok || v != token {
+		t.Errorf("QueryTransport.Extract() = %q, %v", v, ok)
+	}
+}
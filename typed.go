@@ -0,0 +1,81 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+// payloadKey is Values key of typed session payload
+const payloadKey = "_gws_payload"
+
+// Get return typed value of the key. Values decoded by a codec that loses
+// Go types, e.g. JSONCodec, are converted to T through the same codec and
+// the converted value is put back to Values.
+func Get[T any](s *Session, key string) (T, bool) {
+	var zero T
+	v, ok := s.Values[key]
+	if !ok {
+		return zero, false
+	}
+	if t, ok := v.(T); ok {
+		return t, true
+	}
+	var t T
+	if err := convert(s.manager().codec(), v, &t); err != nil {
+		debug.trace(err)
+		return zero, false
+	}
+	s.Values[key] = t
+	return t, true
+}
+
+// Set set typed value of the key
+func Set[T any](s *Session, key string, v T) {
+	s.Values[key] = v
+}
+
+// TypedSession is session which stores a single user-defined payload.
+type TypedSession[T any] struct {
+	*Session
+}
+
+// Typed return typed session of the session
+func Typed[T any](s *Session) *TypedSession[T] {
+	return &TypedSession[T]{Session: s}
+}
+
+// Payload return session payload
+func (ts *TypedSession[T]) Payload() (T, bool) {
+	return Get[T](ts.Session, payloadKey)
+}
+
+// SetPayload set session payload
+func (ts *TypedSession[T]) SetPayload(v T) {
+	Set(ts.Session, payloadKey, v)
+}
+
+// convert value to typed pointer through codec
+func convert(codec Codec, v interface{}, ptr interface{}) error {
+	data, err := codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(data, ptr)
+}
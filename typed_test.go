@@ -0,0 +1,60 @@
+// MIT License
+
+// Copyright (c) 2022 Leon Ding
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gws
+
+import (
+	"testing"
+)
+
+// TestTypedSession testing typed payload after codec round trip
+func TestTypedSession(t *testing.T) {
+	opt := NewOptions()
+	m, _ := NewManager(&opt, NewRAM())
+	m.cfg.Codec = JSONCodec{}
+
+	s := m.NewSession()
+	Typed[*userInfo](s).SetPayload(&userInfo{UserName: "Leon Ding", Age: 21})
+	Set(s, "count", 7)
+
+	// simulate a redis round trip which loses Go types
+	data, err := JSONCodec{}.Encode(s.record())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r record
+	if err := (JSONCodec{}).Decode(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	s.restore(&r)
+
+	user, ok := Typed[*userInfo](s).Payload()
+	if !ok || user.UserName != "Leon Ding" || user.Age != 21 {
+		t.Errorf("Payload() = %v, %v", user, ok)
+	}
+	if count, ok := Get[int](s, "count"); !ok || count != 7 {
+		t.Errorf("Get() = %v, %v", count, ok)
+	}
+	if _, ok := Get[int](s, "missing"); ok {
+		t.Error("Get() missing key should not be ok")
+	}
+}